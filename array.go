@@ -0,0 +1,124 @@
+package conflate
+
+import (
+	"path"
+	"reflect"
+)
+
+// ArrayStrategy defines how an array is merged into the array it overrides.
+type ArrayStrategy string
+
+const (
+	// ArrayAppend appends the items to the overridden array, which is the default.
+	ArrayAppend ArrayStrategy = "append"
+	// ArrayPrepend inserts the items before those of the overridden array.
+	ArrayPrepend ArrayStrategy = "prepend"
+	// ArrayReplace replaces the overridden array.
+	ArrayReplace ArrayStrategy = "replace"
+	// ArrayUnion appends only the items that are not already in the overridden array.
+	ArrayUnion ArrayStrategy = "union"
+	// ArrayKeyed merges objects that have the same value for the key property, and appends the rest.
+	ArrayKeyed ArrayStrategy = "keyed"
+)
+
+// ArrayMerge configures how an array is merged into the array it overrides.
+type ArrayMerge struct {
+	Strategy ArrayStrategy
+	// Key names the property that identifies the objects in the array, for the ArrayKeyed strategy.
+	Key string
+}
+
+type pathArrayMerge struct {
+	path  string
+	merge ArrayMerge
+}
+
+// mergeRules holds the merge configuration of a Conflate instance.
+type mergeRules struct {
+	global ArrayMerge
+	paths  []pathArrayMerge
+	// schema is the root of a JSON schema that declares merge directives, see Conflate.MergeSchema.
+	schema interface{}
+	// nullDeletes treats a null object property like the deletion marker, see Conflate.NullDeletes.
+	nullDeletes bool
+	// typeConflict is the policy for merging values of different types, see Conflate.TypeConflict.
+	typeConflict TypeConflict
+	// funcs are the merge functions registered for paths, see Conflate.MergeFunc.
+	funcs []pathMergeFunc
+}
+
+// arrayMerge returns the configuration for the array at the JSON pointer.
+// The last path added which matches the pointer wins, then any directive in the schema,
+// otherwise the global configuration is used.
+func (a mergeRules) arrayMerge(ptr string) ArrayMerge {
+	for i := len(a.paths) - 1; i >= 0; i-- {
+		if matchPath(a.paths[i].path, ptr) {
+			return a.paths[i].merge
+		}
+	}
+
+	if d, ok := schemaDirective(a.schema, ptr); ok {
+		strategy := ArrayStrategy(d.merge)
+		if strategy == "" && d.key != "" {
+			strategy = ArrayKeyed
+		}
+
+		return ArrayMerge{Strategy: strategy, Key: d.key}
+	}
+
+	return a.global
+}
+
+// objectMerge returns how the object at the JSON pointer is merged, which is only configurable in the schema.
+func (a mergeRules) objectMerge(ptr string) string {
+	d, _ := schemaDirective(a.schema, ptr)
+
+	return d.merge
+}
+
+// withPath returns a copy of the configuration with the path added, so that copies already taken are unaffected.
+func (a mergeRules) withPath(p string, m ArrayMerge) mergeRules {
+	paths := make([]pathArrayMerge, len(a.paths), len(a.paths)+1)
+	copy(paths, a.paths)
+	a.paths = append(paths, pathArrayMerge{path: p, merge: m})
+
+	return a
+}
+
+// matchPath reports whether the JSON pointer equals the path, or matches it as a glob pattern such as /servers/*/ports.
+func matchPath(pattern, ptr string) bool {
+	if pattern == ptr {
+		return true
+	}
+
+	ok, err := path.Match(pattern, ptr)
+
+	return err == nil && ok
+}
+
+func containsItem(items []interface{}, item interface{}) bool {
+	for _, i := range items {
+		if reflect.DeepEqual(i, item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// indexOfKey returns the index of the object in items with the same key value as the item, or -1 if there is none.
+func indexOfKey(items []interface{}, key string, item interface{}) int {
+	obj, ok := item.(map[string]interface{})
+	if !ok || obj[key] == nil {
+		return -1
+	}
+
+	for i, it := range items {
+		o, ok := it.(map[string]interface{})
+		if ok && reflect.DeepEqual(o[key], obj[key]) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,133 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/allowed_origins", "/allowed_origins"))
+	assert.True(t, matchPath("/servers/*/ports", "/servers/0/ports"))
+	assert.False(t, matchPath("/servers/*/ports", "/servers/0/tls/ports"))
+	assert.False(t, matchPath("/servers/[", "/servers/0"))
+	assert.True(t, matchPath("/servers/[", "/servers/["))
+}
+
+func TestMergeRules_ArrayMerge(t *testing.T) {
+	var a mergeRules
+	assert.Equal(t, ArrayMerge{}, a.arrayMerge("/x"))
+
+	a.global = ArrayMerge{Strategy: ArrayUnion}
+	b := a.withPath("/x", ArrayMerge{Strategy: ArrayReplace})
+	b = b.withPath("/*", ArrayMerge{Strategy: ArrayPrepend})
+	b = b.withPath("/y", ArrayMerge{Strategy: ArrayKeyed, Key: "name"})
+
+	assert.Equal(t, ArrayMerge{Strategy: ArrayUnion}, a.arrayMerge("/x"))
+	assert.Equal(t, ArrayMerge{Strategy: ArrayPrepend}, b.arrayMerge("/x"))
+	assert.Equal(t, ArrayMerge{Strategy: ArrayKeyed, Key: "name"}, b.arrayMerge("/y"))
+	assert.Equal(t, ArrayMerge{Strategy: ArrayUnion}, b.arrayMerge("/x/0/z"))
+}
+
+func TestIndexOfKey(t *testing.T) {
+	items := []interface{}{
+		"x",
+		map[string]interface{}{"name": "a"},
+		map[string]interface{}{"name": "b"},
+	}
+	assert.Equal(t, 2, indexOfKey(items, "name", map[string]interface{}{"name": "b", "v": 1}))
+	assert.Equal(t, -1, indexOfKey(items, "name", map[string]interface{}{"name": "c"}))
+	assert.Equal(t, -1, indexOfKey(items, "name", map[string]interface{}{"v": 1}))
+	assert.Equal(t, -1, indexOfKey(items, "name", "x"))
+}
+
+func TestMerge_ArrayAppend(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayAppend}}},
+		`{"a": [1, 2]}`, `{"a": [2, 3]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [1, 2, 2, 3]}`)), data)
+}
+
+func TestMerge_ArrayPrepend(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayPrepend}}},
+		`{"a": [1, 2]}`, `{"a": [2, 3]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [2, 3, 1, 2]}`)), data)
+}
+
+func TestMerge_ArrayReplace(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayReplace}}},
+		`{"a": [1, 2]}`, `{"a": [3]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [3]}`)), data)
+}
+
+func TestMerge_ArrayUnion(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayUnion}}},
+		`{"a": [1, {"x": 1}]}`, `{"a": [{"x": 1}, 3, 3, 1]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [1, {"x": 1}, 3]}`)), data)
+}
+
+func TestMerge_ArrayKeyed(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayKeyed, Key: "name"}}},
+		`{"a": [{"name": "x", "v": 1, "w": 1}, {"name": "y", "v": 1}, "s"]}`,
+		`{"a": [{"name": "y", "v": 2}, {"name": "z", "v": 3}, {"v": 4}, "s"]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t,
+		[]byte(`{"a": [{"name": "x", "v": 1, "w": 1}, {"name": "y", "v": 2}, "s", {"name": "z", "v": 3}, {"v": 4}, "s"]}`)), data)
+}
+
+func TestMerge_ArrayKeyedError(t *testing.T) {
+	_, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayKeyed, Key: "name"}}},
+		`{"a": [{"name": "x", "v": 1}]}`, `{"a": [{"name": "x", "v": "s"}]}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "#/a[0]/v")
+}
+
+func TestMerge_ArrayKeyedNoKey(t *testing.T) {
+	_, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayKeyed}}},
+		`{"a": [1]}`, `{"a": [2]}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "requires a key")
+}
+
+func TestMerge_ArrayUnknownStrategy(t *testing.T) {
+	_, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: "other"}}},
+		`{"a": [1]}`, `{"a": [2]}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown array merge strategy : other")
+}
+
+func TestConflate_PathArrayMerge(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.json": `{"allowed_origins": ["a", "b"], "tags": ["x"],
+			"servers": [{"name": "web", "ports": [80]}]}`,
+		"host/prod.json": `{"allowed_origins": ["c"], "tags": ["x", "y"],
+			"servers": [{"name": "web", "ports": [443]}, {"name": "db", "ports": [5432]}]}`,
+	},
+		WithProvenance(true),
+		WithArrayMerge(ArrayMerge{Strategy: ArrayUnion}),
+		WithPathArrayMerge("/allowed_origins", ArrayMerge{Strategy: ArrayReplace}),
+		WithPathArrayMerge("/servers/*/ports", ArrayMerge{Strategy: ArrayPrepend}),
+		WithPathArrayMerge("/servers", ArrayMerge{Strategy: ArrayKeyed, Key: "name"}))
+
+	err := c.AddFiles("mem://host/base.json", "mem://host/prod.json")
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"allowed_origins": ["c"], "tags": ["x", "y"],
+		"servers": [{"name": "web", "ports": [443, 80]}, {"name": "db", "ports": [5432]}]}`)), data)
+
+	assert.Equal(t, `/allowed_origins/0: mem://host/prod.json
+/servers/0/name: mem://host/prod.json (overrides mem://host/base.json)
+/servers/0/ports/0: mem://host/prod.json
+/servers/0/ports/1: mem://host/base.json
+/servers/1/name: mem://host/prod.json
+/servers/1/ports/0: mem://host/prod.json
+/tags/0: mem://host/base.json
+/tags/1: mem://host/prod.json
+`, c.Explain())
+}
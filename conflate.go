@@ -1,34 +1,55 @@
 package conflate
 
 import (
+	gocontext "context"
 	"net/url"
+	"strings"
+	"sync"
 )
 
-// Includes is used to specify the top level key that holds the includes array.
+// Includes is used to specify the default top level key that holds the includes array.
+// It is read when a Conflate instance is constructed, see WithIncludesKey to configure a single instance.
 var Includes = "includes"
 
 // Conflate contains a 'working' merged data set and optionally a JSON v4 schema.
+// It is safe for concurrent use by multiple goroutines.
 type Conflate struct {
-	data   interface{}
-	loader loader
+	mu         sync.RWMutex
+	data       interface{}
+	loader     loader
+	provenance provenances
+	positions  origins
+	rules      mergeRules
+	warnings   []string
 }
 
-// New constructs a new empty Conflate instance.
-func New() *Conflate {
+// New constructs a new empty Conflate instance, configured by the given options.
+// Any setting not given as an option defaults to the corresponding package level variable, at the time of the call.
+func New(opts ...Option) *Conflate {
 	initFormatCheckers()
 
-	return &Conflate{
-		loader: loader{
-			newFiledata: newFiledata,
-		},
+	c := &Conflate{
+		loader:    newLoader(),
+		positions: origins{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
 }
 
 // FromFiles constructs a new Conflate instance populated with the data from the given files.
 func FromFiles(paths ...string) (*Conflate, error) {
+	return FromFilesContext(gocontext.Background(), paths...)
+}
+
+// FromFilesContext is like FromFiles, but aborts loading when ctx is done.
+func FromFilesContext(ctx gocontext.Context, paths ...string) (*Conflate, error) {
 	c := New()
 
-	err := c.AddFiles(paths...)
+	err := c.AddFilesContext(ctx, paths...)
 	if err != nil {
 		return nil, err
 	}
@@ -38,9 +59,14 @@ func FromFiles(paths ...string) (*Conflate, error) {
 
 // FromURLs constructs a new Conflate instance populated with the data from the given URLs.
 func FromURLs(urls ...*url.URL) (*Conflate, error) {
+	return FromURLsContext(gocontext.Background(), urls...)
+}
+
+// FromURLsContext is like FromURLs, but aborts loading when ctx is done.
+func FromURLsContext(ctx gocontext.Context, urls ...*url.URL) (*Conflate, error) {
 	c := New()
 
-	err := c.AddURLs(urls...)
+	err := c.AddURLsContext(ctx, urls...)
 	if err != nil {
 		return nil, err
 	}
@@ -50,9 +76,14 @@ func FromURLs(urls ...*url.URL) (*Conflate, error) {
 
 // FromData constructs a new Conflate instance populated with the given data.
 func FromData(data ...[]byte) (*Conflate, error) {
+	return FromDataContext(gocontext.Background(), data...)
+}
+
+// FromDataContext is like FromData, but aborts loading of any includes when ctx is done.
+func FromDataContext(ctx gocontext.Context, data ...[]byte) (*Conflate, error) {
 	c := New()
 
-	err := c.AddData(data...)
+	err := c.AddDataContext(ctx, data...)
 	if err != nil {
 		return nil, err
 	}
@@ -62,9 +93,14 @@ func FromData(data ...[]byte) (*Conflate, error) {
 
 // FromGo constructs a new Conflate instance populated with the given golang objects.
 func FromGo(data ...interface{}) (*Conflate, error) {
+	return FromGoContext(gocontext.Background(), data...)
+}
+
+// FromGoContext is like FromGo, but aborts loading of any includes when ctx is done.
+func FromGoContext(ctx gocontext.Context, data ...interface{}) (*Conflate, error) {
 	c := New()
 
-	err := c.AddGo(data...)
+	err := c.AddGoContext(ctx, data...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,28 +108,295 @@ func FromGo(data ...interface{}) (*Conflate, error) {
 	return c, nil
 }
 
+// Clone returns a snapshot of the Conflate instance, with the same configuration and a copy of the data merged so far,
+// along with its provenance and warnings. Data merged into either instance afterwards does not affect the other.
+func (c *Conflate) Clone() *Conflate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &Conflate{
+		data:       deepCopy(c.data),
+		loader:     c.loader,
+		provenance: c.provenance.clone(),
+		positions:  c.positions.clone(),
+		rules:      c.rules,
+		warnings:   append([]string(nil), c.warnings...),
+	}
+}
+
 // Expand is an option to automatically expand environment variables in data files.
 func (c *Conflate) Expand(expand bool) {
-	if expand {
-		c.loader.newFiledata = newExpandedFiledata
-	} else {
-		c.loader.newFiledata = newFiledata
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loader.expand = expand
+}
+
+// NestedIncludes is an option to honour the includes declared inside the data, rather than only by the includes
+// array at the top level. Any object, including the root, may then declare includes with a "$include" key, which
+// takes a single include or an array of them, and any nested object with an includes array, unless the includes key
+// is blank. The included data is merged under the object that declares the includes, and for an object that is
+// an item of an array, it is merged under the item before the item is merged. It is off by default, so that data
+// with such keys keeps its meaning.
+func (c *Conflate) NestedIncludes(nested bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loader.nestedIncludes = nested
+}
+
+// SelectDocuments chooses which documents of YAML streams of several documents are merged, see DocumentIndex and
+// DocumentMatch. Each document that is merged is merged over the previous ones, and all of them are merged
+// if the selector is nil, which is the default. Streams of a single document are always merged.
+func (c *Conflate) SelectDocuments(sel DocumentSelector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loader.documents = sel
+}
+
+// PatchSuffixes is an option to apply the files whose names end in .merge-patch or .json-patch before the extension,
+// such as prod.merge-patch.yaml, as JSON merge patches or JSON patches, whether they are included or added.
+// Otherwise only the includes with a patch field, such as {"path": "prod.yaml", "patch": "merge"}, are applied as patches.
+func (c *Conflate) PatchSuffixes(suffixes bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loader.patchSuffixes = suffixes
+}
+
+// INITypes is an option to unmarshal the unquoted values of .ini files which are numbers or booleans as such,
+// rather than as strings, see NewINIUnmarshaller. It has no effect on unmarshallers set by WithUnmarshallers.
+func (c *Conflate) INITypes(typed bool) {
+	c.setUnmarshallers(UnmarshallerMap{".ini": {NewINIUnmarshaller(typed)}})
+}
+
+// DotenvTypes is an option to unmarshal the unquoted values of .env files which are numbers or booleans as such,
+// rather than as strings, see NewDotenvUnmarshaller. It has no effect on unmarshallers set by WithUnmarshallers.
+func (c *Conflate) DotenvTypes(typed bool) {
+	c.setUnmarshallers(UnmarshallerMap{".env": {NewDotenvUnmarshaller(typed)}})
+}
+
+// PropertiesTypes is an option to unmarshal the values of .properties files which are numbers or booleans as such,
+// rather than as strings, see NewPropertiesUnmarshaller. It has no effect on unmarshallers set by WithUnmarshallers.
+func (c *Conflate) PropertiesTypes(typed bool) {
+	c.setUnmarshallers(UnmarshallerMap{".properties": {NewPropertiesUnmarshaller(typed)}})
+}
+
+// LenientJSON is an option to unmarshal .json files which are not valid JSON as JSON5, see JSON5Unmarshal,
+// so that they may have comments and trailing commas. Files with the .json5 and .jsonc extensions are always
+// unmarshalled as JSON5. It has no effect on unmarshallers set by WithUnmarshallers.
+func (c *Conflate) LenientJSON(lenient bool) {
+	funcs := UnmarshallerFuncs{JSONUnmarshal}
+	if lenient {
+		funcs = append(funcs, JSON5Unmarshal)
+	}
+
+	c.setUnmarshallers(UnmarshallerMap{".json": funcs, ".jsn": funcs})
+}
+
+// setUnmarshallers sets the unmarshallers for the given extensions, keeping those for other extensions,
+// unless the unmarshallers were set by WithUnmarshallers.
+func (c *Conflate) setUnmarshallers(set UnmarshallerMap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loader.customUnmarshallers {
+		return
+	}
+
+	// the map is replaced rather than updated, as copies of the loader may be in use by concurrent loads
+	unmarshallers := UnmarshallerMap{}
+
+	for ext, funcs := range c.loader.unmarshallers {
+		unmarshallers[ext] = funcs
+	}
+
+	for ext, funcs := range set {
+		unmarshallers[ext] = funcs
+	}
+
+	c.loader.unmarshallers = unmarshallers
+}
+
+// TrackProvenance is an option to record which source set each value, as the data is merged.
+// Only data merged after tracking is switched on is recorded.
+func (c *Conflate) TrackProvenance(track bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case !track:
+		c.provenance = nil
+	case c.provenance == nil:
+		c.provenance = provenances{}
+	}
+}
+
+// Provenance returns which source set the value at the given JSON pointer, and which sources it overrode.
+// It returns nil if provenance is not being tracked, or the pointer does not locate a scalar value or an array item.
+// If the value was deleted, or the last item of an array deleted at the pointer has not been replaced,
+// the provenance records the deletion instead.
+func (c *Conflate) Provenance(path string) *Provenance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.provenance.get(path)
+}
+
+// Lookup returns a copy of the value located by the given JSON pointer within the data.
+func (c *Conflate) Lookup(path string) (interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	val, err := lookupPointer(c.data, path)
+	if err != nil {
+		return nil, err
 	}
+
+	return deepCopy(val), nil
+}
+
+// Explain describes the provenance of every value in the data, one per line ordered by JSON pointer.
+func (c *Conflate) Explain() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var sb strings.Builder
+
+	for _, prov := range c.provenance.sorted() {
+		sb.WriteString(prov.String())
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// ArrayMerge sets how arrays are merged into the arrays they override, where no path specific configuration applies.
+// By default the items are appended.
+func (c *Conflate) ArrayMerge(m ArrayMerge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules.global = m
+}
+
+// PathArrayMerge sets how the arrays located by path are merged into the arrays they override.
+// The path is either a JSON pointer such as /allowed_origins, or a glob pattern such as /servers/*/ports.
+// Where several paths match an array, the last one set wins.
+func (c *Conflate) PathArrayMerge(path string, m ArrayMerge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules = c.rules.withPath(path, m)
+}
+
+// MergeSchema sets a schema whose x-merge and x-merge-key keywords configure how the data is merged.
+// On an array node, x-merge names an ArrayStrategy and x-merge-key names the key property for the keyed strategy,
+// which is implied if x-merge is absent. On an object node, x-merge is either "merge", the default, or "replace".
+// Arrays configured with PathArrayMerge ignore the schema. A nil schema removes any schema set before.
+func (c *Conflate) MergeSchema(s *Schema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules.schema = nil
+	if s != nil {
+		c.rules.schema = s.s
+	}
+}
+
+// NullDeletes is an option to delete an object property when it is overridden with null,
+// as well as when it is overridden with the "$delete" marker. By default null leaves the property unchanged.
+func (c *Conflate) NullDeletes(deletes bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules.nullDeletes = deletes
+}
+
+// TypeConflict sets the policy for merging a value into an overridden value of a different type,
+// such as a string into a number, or a scalar into an object. By default the merge fails.
+func (c *Conflate) TypeConflict(policy TypeConflict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules.typeConflict = policy
+}
+
+// MergeFunc registers a function that merges the values located by path into the values they override,
+// in place of the default merge. The path is either a JSON pointer such as /version,
+// or a glob pattern such as /features/*. Where several paths match a value, the last one registered wins,
+// and a nil function restores the default merge. The function is not called for values that override nothing.
+func (c *Conflate) MergeFunc(path string, fn MergeFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules = c.rules.withMergeFunc(path, fn)
+}
+
+// Warnings returns any warnings about the data merged so far, such as values overridden by the TypeConflictWarn policy.
+func (c *Conflate) Warnings() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]string(nil), c.warnings...)
+}
+
+// Concurrency sets the maximum number of sibling includes that are fetched in parallel.
+// Included data is always merged in the declared order, whatever order it is fetched in.
+// Values below 1 are treated as 1, meaning includes are fetched sequentially.
+func (c *Conflate) Concurrency(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loader.concurrency = n
+}
+
+// RegisterLoader sets the loader used by the Conflate instance for the given url scheme.
+// It takes precedence over any loader registered globally in Loaders for the same scheme.
+func (c *Conflate) RegisterLoader(scheme string, l Loader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+
+	// the map is replaced rather than updated, as copies of the loader may be in use by concurrent loads
+	loaders := LoaderMap{scheme: l}
+
+	for s, ldr := range c.loader.loaders {
+		if s != scheme {
+			loaders[s] = ldr
+		}
+	}
+
+	c.loader.loaders = loaders
 }
 
 // AddFiles recursively merges the data from the given files into the Conflate instance.
 func (c *Conflate) AddFiles(paths ...string) error {
+	return c.AddFilesContext(gocontext.Background(), paths...)
+}
+
+// AddFilesContext is like AddFiles, but aborts loading when ctx is done.
+func (c *Conflate) AddFilesContext(ctx gocontext.Context, paths ...string) error {
 	urls, err := toURLs(nil, paths...)
 	if err != nil {
 		return err
 	}
 
-	return c.AddURLs(urls...)
+	return c.AddURLsContext(ctx, urls...)
 }
 
 // AddURLs recursively merges the data from the given urls into the Conflate instance.
 func (c *Conflate) AddURLs(urls ...*url.URL) error {
-	data, err := c.loader.loadURLsRecursive(nil, urls...)
+	return c.AddURLsContext(gocontext.Background(), urls...)
+}
+
+// AddURLsContext is like AddURLs, but aborts loading when ctx is done.
+func (c *Conflate) AddURLsContext(ctx gocontext.Context, urls ...*url.URL) error {
+	l := c.getLoader()
+
+	data, err := l.loadURLsRecursive(ctx, nil, urls...)
 	if err != nil {
 		return err
 	}
@@ -103,56 +406,155 @@ func (c *Conflate) AddURLs(urls ...*url.URL) error {
 
 // AddGo recursively merges the given (json-serializable) golang objects into the Conflate instance.
 func (c *Conflate) AddGo(objs ...interface{}) error {
+	return c.AddGoContext(gocontext.Background(), objs...)
+}
+
+// AddGoContext is like AddGo, but aborts loading of any includes when ctx is done.
+func (c *Conflate) AddGoContext(ctx gocontext.Context, objs ...interface{}) error {
 	data, err := jsonMarshalAll(objs...)
 	if err != nil {
 		return err
 	}
 
-	return c.AddData(data...)
+	return c.AddDataContext(ctx, data...)
 }
 
 // AddData recursively merges the given data into the Conflate instance.
 func (c *Conflate) AddData(data ...[]byte) error {
-	fdata, err := c.loader.wrapFiledatas(data...)
+	return c.AddDataContext(gocontext.Background(), data...)
+}
+
+// AddDataContext is like AddData, but aborts loading of any includes when ctx is done.
+func (c *Conflate) AddDataContext(ctx gocontext.Context, data ...[]byte) error {
+	l := c.getLoader()
+
+	fdata, err := l.wrapFiledatas(data...)
 	if err != nil {
 		return err
 	}
 
-	return c.addData(fdata...)
+	return c.addData(ctx, &l, fdata...)
+}
+
+// ApplyMergePatch applies a JSON merge patch (RFC 7386) to the data, where null deletes a value.
+// Includes with "patch": "merge" are applied as merge patches in the same way, see also PatchSuffixes.
+func (c *Conflate) ApplyMergePatch(patch []byte) error {
+	return c.applyPatch(patch, mergePatch)
+}
+
+// ApplyJSONPatch applies a JSON patch (RFC 6902) to the data, leaving the data unchanged if any operation fails.
+// Includes with "patch": "json" are applied as JSON patches in the same way, see also PatchSuffixes.
+func (c *Conflate) ApplyJSONPatch(patch []byte) error {
+	return c.applyPatch(patch, jsonPatch)
+}
+
+func (c *Conflate) applyPatch(patch []byte, kind patchKind) error {
+	l := c.getLoader()
+
+	fd, err := l.newPatchFiledata(patch, &emptyURL, kind)
+	if err != nil {
+		return err
+	}
+
+	return c.mergeData(fd)
 }
 
 // ApplyDefaults sets any nil or missing values in the data, to the default values defined in the JSON v4 schema.
 func (c *Conflate) ApplyDefaults(s *Schema) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return s.ApplyDefaults(&c.data)
 }
 
 // Validate checks the data against the JSON v4 schema.
 func (c *Conflate) Validate(s *Schema) error {
-	return s.Validate(c.data)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if s == nil {
+		return errNotSetSchema
+	}
+
+	return validateAt(c.data, s.s, c.positions)
 }
 
 // Unmarshal extracts the data as a Golang object.
 func (c *Conflate) Unmarshal(out interface{}) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return jsonMarshalUnmarshal(c.data, out)
 }
 
 // MarshalJSON exports the data as JSON.
 func (c *Conflate) MarshalJSON() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return jsonMarshal(c.data)
 }
 
 // MarshalYAML exports the data as YAML.
 func (c *Conflate) MarshalYAML() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return yamlMarshal(c.data)
 }
 
 // MarshalTOML exports the data as TOML.
 func (c *Conflate) MarshalTOML() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return tomlMarshal(c.data)
 }
 
-func (c *Conflate) addData(fdata ...filedata) error {
-	fdata, err := c.loader.loadDataRecursive(nil, fdata...)
+// MarshalHCL exports the data as HCL2 native syntax, where objects are written as blocks where possible.
+func (c *Conflate) MarshalHCL() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return hclMarshal(c.data)
+}
+
+// MarshalDotenv exports the data as dotenv KEY=value lines, where the keys of nested objects and the indexes of arrays
+// are upper cased and joined by double underscores, as in DB__HOST.
+func (c *Conflate) MarshalDotenv() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return dotenvMarshal(c.data)
+}
+
+// MarshalProperties exports the data as a Java properties file, where the keys of nested objects and the indexes
+// of arrays are joined by dots, as in db.host.
+func (c *Conflate) MarshalProperties() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return propertiesMarshal(c.data)
+}
+
+// MarshalINI exports the data as an INI file, where the top level objects and their nested objects are sections
+// named by the keys joined by dots, as in [database.replica], and arrays are written as repeated keys ending in [].
+func (c *Conflate) MarshalINI() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return iniMarshal(c.data)
+}
+
+func (c *Conflate) getLoader() loader {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.loader
+}
+
+func (c *Conflate) addData(ctx gocontext.Context, l *loader, fdata ...filedata) error {
+	fdata, err := l.loadDataRecursive(ctx, nil, fdata...)
 	if err != nil {
 		return err
 	}
@@ -161,7 +563,90 @@ func (c *Conflate) addData(fdata ...filedata) error {
 }
 
 func (c *Conflate) mergeData(fdata ...filedata) error {
-	doms := filedatas(fdata).objs()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, fd := range fdata {
+		m := merger{
+			source:     fd.source(),
+			provenance: c.provenance,
+			positions:  fd.positions,
+			merged:     c.positions,
+			rules:      c.rules,
+			warnings:   &c.warnings,
+		}
+
+		var err error
+
+		switch fd.patch {
+		case mergePatch:
+			c.data = m.mergePatch(rootContext(), rootContext(), c.data, fd.patchDoc)
+		case jsonPatch:
+			err = c.applyJSONPatch(m, fd)
+		default:
+			err = c.mergeItems(fd)
+			if err == nil {
+				err = m.merge(&c.data, fd.obj)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeItems replaces each item of an array that declares includes with the data merged from them and the item.
+// The values merged under the item are recorded as if they were set by the data that declares the item.
+func (c *Conflate) mergeItems(fd filedata) error {
+	for _, item := range fd.items {
+		var value interface{}
+
+		for _, itemFd := range item.fdata {
+			m := merger{source: itemFd.source(), rules: c.rules, warnings: &c.warnings}
+
+			var err error
+
+			switch itemFd.patch {
+			case mergePatch:
+				value = m.mergePatch(rootContext(), rootContext(), value, itemFd.patchDoc)
+			case jsonPatch:
+				err = itemFd.wrapError(m.jsonPatch(&value, itemFd.patchDoc))
+			default:
+				err = c.mergeItems(itemFd)
+				if err == nil {
+					err = m.merge(&value, itemFd.obj)
+				}
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err := setPointer(fd.obj, item.ptr, value)
+		if err != nil {
+			return fd.wrapError(err)
+		}
+	}
+
+	return nil
+}
+
+// applyJSONPatch applies all of the operations of the patch to the data, or none of them if any operation fails.
+func (c *Conflate) applyJSONPatch(m merger, fd filedata) error {
+	data := deepCopy(c.data)
+	m.provenance = c.provenance.clone()
+	m.merged = c.positions.clone()
+
+	err := m.jsonPatch(&data, fd.patchDoc)
+	if err != nil {
+		return fd.wrapError(err)
+	}
+
+	c.data, c.provenance, c.positions = data, m.provenance, m.merged
 
-	return mergeTo(&c.data, doms...)
+	return nil
 }
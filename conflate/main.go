@@ -2,10 +2,12 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/miracl/conflate"
@@ -22,16 +24,25 @@ func failIfError(err error) {
 
 //nolint:funlen // that's ok
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		explain(os.Args[2:])
+
+		return
+	}
+
 	var data dataFlag
 
 	flag.Var(&data, "data", "The path/url of JSON/YAML/TOML data, or 'stdin' to read from standard input")
 	schemaFile := flag.String("schema", "", "The path/url of a JSON v4 schema file")
 	defaults := flag.Bool("defaults", false, "Apply defaults from schema to data")
 	validate := flag.Bool("validate", false, "Validate the data against the schema")
-	format := flag.String("format", "", "Output format of the data JSON/YAML/TOML")
+	format := flag.String("format", "", "Output format of the data JSON/YAML/TOML/HCL/INI/DOTENV/PROPERTIES")
 	includes := flag.String("includes", "includes", "Name of includes array. Blank string suppresses expansion of includes arrays")
 	noincludes := flag.Bool("noincludes", false, "Switches off conflation of includes. Overrides any --includes setting.")
 	expand := flag.Bool("expand", false, "Expand environment variables in files")
+	lenient := flag.Bool("lenient", false, "Allow comments and trailing commas in .json files, as in JSON5")
+	document := flag.String("document", "", "Merge only the given documents of YAML streams, by index e.g. 1, or by key e.g. profile=prod")
+	graph := flag.String("graph", "", "Output the include graph as DOT/JSON/LIST, without merging the data")
 	showVersion := flag.Bool("version", false, "Display the version number")
 
 	flag.Parse()
@@ -42,31 +53,21 @@ func main() {
 		return
 	}
 
-	conflate.Includes = *includes
 	if *noincludes {
-		conflate.Includes = ""
+		*includes = ""
 	}
 
-	c := conflate.New()
-	c.Expand(*expand)
+	c := conflate.New(conflate.WithIncludesKey(*includes), conflate.WithExpand(*expand), conflate.WithLenientJSON(*lenient),
+		conflate.WithDocumentSelector(documentSelector(*document)))
 
-	if len(data) == 0 {
-		data = append(data, "stdin")
-	}
+	if *graph != "" {
+		printGraph(c, data, *graph)
 
-	for _, d := range data {
-		if d == "stdin" {
-			b, err := io.ReadAll(os.Stdin)
-			failIfError(err)
-
-			err = c.AddData(b)
-			failIfError(err)
-		} else {
-			err := c.AddFiles(d)
-			failIfError(err)
-		}
+		return
 	}
 
+	addData(c, data)
+
 	var schema *conflate.Schema
 
 	if *schemaFile != "" {
@@ -100,6 +101,14 @@ func main() {
 			out, err = c.MarshalYAML()
 		case "TOML":
 			out, err = c.MarshalTOML()
+		case "HCL":
+			out, err = c.MarshalHCL()
+		case "INI":
+			out, err = c.MarshalINI()
+		case "DOTENV":
+			out, err = c.MarshalDotenv()
+		case "PROPERTIES":
+			out, err = c.MarshalProperties()
 		}
 
 		failIfError(err)
@@ -111,6 +120,151 @@ func main() {
 	}
 }
 
+// explain prints the value at a path in the conflated data, the source that set it,
+// and the sources it overrode in the order they were included.
+func explain(args []string) {
+	var data dataFlag
+
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	flags.Var(&data, "data", "The path/url of JSON/YAML/TOML data, or 'stdin' to read from standard input")
+	path := flags.String("path", "", "The JSON pointer of the value to explain, e.g. /db/host")
+	includes := flags.String("includes", "includes", "Name of includes array. Blank string suppresses expansion of includes arrays")
+	noincludes := flags.Bool("noincludes", false, "Switches off conflation of includes. Overrides any --includes setting.")
+	expand := flags.Bool("expand", false, "Expand environment variables in files")
+	lenient := flags.Bool("lenient", false, "Allow comments and trailing commas in .json files, as in JSON5")
+	document := flags.String("document", "", "Merge only the given documents of YAML streams, by index e.g. 1, or by key e.g. profile=prod")
+
+	err := flags.Parse(args)
+	failIfError(err)
+
+	if *noincludes {
+		*includes = ""
+	}
+
+	c := conflate.New(conflate.WithIncludesKey(*includes), conflate.WithExpand(*expand), conflate.WithLenientJSON(*lenient),
+		conflate.WithDocumentSelector(documentSelector(*document)), conflate.WithProvenance(true))
+
+	addData(c, data)
+
+	val, err := c.Lookup(*path)
+	failIfError(err)
+
+	out, err := json.Marshal(val)
+	failIfError(err)
+
+	fmt.Printf("value: %s\n", out)
+
+	prov := c.Provenance(*path)
+	if prov == nil {
+		fmt.Println("set by: unknown, the path does not locate a single value")
+
+		return
+	}
+
+	fmt.Printf("set by: %v\n", sourceName(prov.Source))
+
+	for _, source := range prov.Overridden {
+		fmt.Printf("overrides: %v\n", sourceName(source))
+	}
+}
+
+func sourceName(source string) string {
+	if source == "" {
+		return "stdin"
+	}
+
+	return source
+}
+
+// documentSelector parses the selector of the documents of YAML streams, which is an index, or key=value where
+// the key is a top level key or a JSON pointer.
+func documentSelector(s string) conflate.DocumentSelector {
+	if s == "" {
+		return nil
+	}
+
+	if key, value, ok := strings.Cut(s, "="); ok {
+		if !strings.HasPrefix(key, "/") {
+			key = "/" + key
+		}
+
+		return conflate.DocumentMatch(key, value)
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		failIfError(fmt.Errorf("invalid document selector : %v", s))
+	}
+
+	return conflate.DocumentIndex(i)
+}
+
+func addData(c *conflate.Conflate, data dataFlag) {
+	if len(data) == 0 {
+		data = append(data, "stdin")
+	}
+
+	for _, d := range data {
+		if d == "stdin" {
+			b, err := io.ReadAll(os.Stdin)
+			failIfError(err)
+
+			err = c.AddData(b)
+			failIfError(err)
+		} else {
+			err := c.AddFiles(d)
+			failIfError(err)
+		}
+	}
+}
+
+// printGraph prints the include graph of the data in the given format, without merging the data.
+func printGraph(c *conflate.Conflate, data dataFlag, format string) {
+	if len(data) == 0 {
+		data = append(data, "stdin")
+	}
+
+	var graph conflate.IncludeGraph
+
+	for _, d := range data {
+		var (
+			g   conflate.IncludeGraph
+			b   []byte
+			err error
+		)
+
+		if d == "stdin" {
+			b, err = io.ReadAll(os.Stdin)
+			failIfError(err)
+
+			g, err = c.GraphData(b)
+		} else {
+			g, err = c.GraphFiles(d)
+		}
+
+		failIfError(err)
+
+		graph = append(graph, g...)
+	}
+
+	switch strings.ToUpper(format) {
+	case "DOT":
+		_, err := os.Stdout.Write(graph.DOT())
+		failIfError(err)
+	case "JSON":
+		out, err := json.MarshalIndent(graph, "", "  ")
+		failIfError(err)
+
+		fmt.Println(string(out))
+	case "LIST":
+		for _, line := range graph.List() {
+			fmt.Println(line)
+		}
+	default:
+		failIfError(fmt.Errorf("unknown graph format : %v", format))
+	}
+}
+
 type dataFlag []string
 
 func (f *dataFlag) String() string {
@@ -2,6 +2,7 @@ package conflate
 
 import (
 	gocontext "context"
+	"fmt"
 	"net/http"
 	"sync"
 	"testing"
@@ -361,3 +362,164 @@ func TestConflate_mergeDataError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to merge")
 }
+
+func TestConflate_RegisterLoader(t *testing.T) {
+	c := New()
+	c.RegisterLoader("MEM", testMemoryLoader(map[string]string{
+		"host/dir/parent.json": `{"includes": ["child.json"], "x": "parent"}`,
+		"host/dir/child.json":  `{"x": "child", "y": "child"}`,
+	}))
+
+	err := c.AddFiles("mem://host/dir/parent.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": "parent", "y": "child"}, out)
+}
+
+func TestConflate_RegisterLoaderNotGlobal(t *testing.T) {
+	c := New()
+	c.RegisterLoader("mem", testMemoryLoader(map[string]string{}))
+
+	_, ok := Loaders["mem"]
+	assert.False(t, ok)
+}
+
+func TestFromFilesContext_Cancelled(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	c, err := FromFilesContext(ctx, "testdata/valid_parent.json")
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+}
+
+func TestAddDataContext_CancelledInclude(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	c := New()
+	err := c.AddDataContext(ctx, []byte(`{"includes": ["testdata/valid_child.json"]}`))
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+}
+
+func TestConflate_Concurrency(t *testing.T) {
+	mem := newTestConcurrentLoader(testConcurrentFiles(), 2)
+
+	c := New()
+	c.Concurrency(2)
+	c.RegisterLoader("mem", mem)
+
+	err := c.AddFiles("mem://host/parent.json")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mem.maxInFlight)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, "c6", out["x"])
+}
+
+func TestConflate_Concurrent(t *testing.T) {
+	c, err := FromFiles("testdata/valid_parent.json")
+	assert.Nil(t, err)
+
+	s, err := NewSchemaFile("testdata/test.schema.json")
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+
+	for i := range 10 {
+		wg.Add(4)
+
+		go func() {
+			defer wg.Done()
+
+			err := c.AddData([]byte(fmt.Sprintf(`{"extra_%v": "value"}`, i)))
+			assert.Nil(t, err)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			err := c.Validate(s)
+			assert.Nil(t, err)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			err := c.ApplyDefaults(s)
+			assert.Nil(t, err)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			_, err := c.MarshalJSON()
+			assert.Nil(t, err)
+
+			c.RegisterLoader(fmt.Sprintf("mem%v", i), testMemoryLoader(nil))
+		}()
+	}
+
+	wg.Wait()
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Len(t, out, 17)
+}
+
+func TestConflate_Lookup(t *testing.T) {
+	c, err := FromData([]byte(`{"db": {"host": "localhost", "ports": [1, 2]}}`))
+	assert.Nil(t, err)
+
+	val, err := c.Lookup("/db/host")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", val)
+
+	val, err = c.Lookup("/db/ports")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1.0, 2.0}, val)
+
+	val.([]interface{})[0] = 3.0
+	val, _ = c.Lookup("/db/ports/0")
+	assert.Equal(t, 1.0, val)
+
+	_, err = c.Lookup("/db/missing")
+	assert.ErrorIs(t, err, errPointerNotFound)
+}
+
+func TestConflate_Clone(t *testing.T) {
+	c := New(WithProvenance(true), WithArrayMerge(ArrayMerge{Strategy: ArrayUnion}), WithTypeConflict(TypeConflictWarn))
+
+	err := c.AddData([]byte(`{"db": {"host": "a", "ports": [1]}}`), []byte(`{"db": {"host": 1}}`))
+	assert.Nil(t, err)
+
+	clone := c.Clone()
+	assert.Equal(t, c.Explain(), clone.Explain())
+	assert.Equal(t, c.Warnings(), clone.Warnings())
+
+	err = clone.AddData([]byte(`{"db": {"host": "b", "ports": [1, 2]}}`))
+	assert.Nil(t, err)
+
+	val, _ := clone.Lookup("/db")
+	assert.Equal(t, testMergeGetData(t, []byte(`{"host": "b", "ports": [1, 2]}`)), val)
+	assert.Len(t, clone.Warnings(), 2)
+
+	val, _ = c.Lookup("/db")
+	assert.Equal(t, testMergeGetData(t, []byte(`{"host": 1, "ports": [1]}`)), val)
+	assert.Len(t, c.Warnings(), 1)
+	assert.Len(t, c.Provenance("/db/host").Overridden, 1)
+	assert.Len(t, clone.Provenance("/db/host").Overridden, 2)
+	assert.Nil(t, c.Provenance("/db/ports/1"))
+	assert.NotNil(t, clone.Provenance("/db/ports/1"))
+}
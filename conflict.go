@@ -0,0 +1,215 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+var errNotCoercible = errors.New("the value cannot be coerced")
+
+// TypeConflict defines how a value is merged into an overridden value of a different type.
+type TypeConflict string
+
+const (
+	// TypeConflictStrict fails the merge, which is the default.
+	TypeConflictStrict TypeConflict = "strict"
+	// TypeConflictOverride replaces the overridden value.
+	TypeConflictOverride TypeConflict = "override"
+	// TypeConflictCoerce converts the value to the type declared for it in the merge schema,
+	// or otherwise to the type of the overridden value, and fails the merge if it cannot be converted.
+	TypeConflictCoerce TypeConflict = "coerce"
+	// TypeConflictWarn replaces the overridden value, and records a warning, see Conflate.Warnings.
+	TypeConflictWarn TypeConflict = "warn"
+)
+
+// conflicts reports whether the value cannot be merged into the overridden value, because their types differ.
+func conflicts(toData, fromData interface{}) bool {
+	if toData == nil || fromData == nil {
+		return false
+	}
+
+	return !reflect.TypeOf(fromData).AssignableTo(reflect.TypeOf(toData))
+}
+
+// resolveConflict merges the value into an overridden value of a different type according to the type conflict policy.
+// It reports false if the policy is strict, so that the conflict is reported as usual.
+func (m merger) resolveConflict(ctx, from context, toVal reflect.Value, toData, fromData interface{}) (bool, error) {
+	switch m.rules.typeConflict {
+	case TypeConflictStrict, "":
+		return false, nil
+	case TypeConflictOverride:
+	case TypeConflictWarn:
+		m.warn(ctx, from, fmt.Sprintf("the destination type (%T) was overridden by the source type (%T)", toData, fromData))
+	case TypeConflictCoerce:
+		coerced, ok := coerce(fromData, m.schemaTypes(ctx, toData))
+		if !ok {
+			return true, m.error(ctx, from, fmt.Sprintf("the source value (%v) could not be coerced to the destination type (%T)",
+				fromData, toData))
+		}
+
+		fromData = coerced
+	default:
+		return true, m.error(ctx, from, fmt.Sprintf("unknown type conflict policy : %v", m.rules.typeConflict))
+	}
+
+	m.overwrite(ctx, from, toData, fromData)
+	toVal.Set(reflect.ValueOf(m.rules.stripDeletes(fromData)))
+
+	return true, nil
+}
+
+// warn records a warning about the value at ctx, if warnings are being collected.
+func (m merger) warn(ctx, from context, msg string) {
+	if m.warnings != nil {
+		*m.warnings = append(*m.warnings, m.error(ctx, from, msg).Error())
+	}
+}
+
+// schemaTypes returns the types that the value at ctx may be coerced to, which are those declared in the merge schema,
+// or otherwise the type of the overridden value.
+func (m merger) schemaTypes(ctx context, toData interface{}) []string {
+	switch t := schemaNode(m.rules.schema, ctx.pointer())["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+
+		return types
+	}
+
+	switch toData.(type) {
+	case string:
+		return []string{"string"}
+	case float64:
+		return []string{"number"}
+	case int64:
+		return []string{"int64"}
+	case bool:
+		return []string{"boolean"}
+	}
+
+	return nil
+}
+
+// coerce converts the value to the first of the JSON schema types that it can be converted to.
+// The int64 type is also accepted, for the integers unmarshalled from TOML.
+func coerce(value interface{}, types []string) (interface{}, bool) {
+	for _, t := range types {
+		var (
+			coerced interface{}
+			err     error
+		)
+
+		switch t {
+		case "string":
+			coerced, err = coerceString(value)
+		case "number":
+			coerced, err = coerceNumber(value)
+		case "integer":
+			coerced, err = coerceInteger(value)
+		case "int64":
+			coerced, err = coerceInt64(value)
+		case "boolean":
+			coerced, err = coerceBoolean(value)
+		default:
+			continue
+		}
+
+		if err == nil {
+			return coerced, true
+		}
+	}
+
+	return nil, false
+}
+
+func coerceString(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	return nil, errNotCoercible
+}
+
+// coerceNumber converts the value to a float64, which must be finite so that it can be marshalled.
+func coerceNumber(value interface{}) (interface{}, error) {
+	var f float64
+
+	switch v := value.(type) {
+	case string:
+		var err error
+
+		f, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+	case float64:
+		f = v
+	case int64:
+		f = float64(v)
+	default:
+		return nil, errNotCoercible
+	}
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, errNotCoercible
+	}
+
+	return f, nil
+}
+
+func coerceInteger(value interface{}) (float64, error) {
+	n, err := coerceNumber(value)
+	if err != nil {
+		return 0, err
+	}
+
+	f, _ := n.(float64)
+	if math.Trunc(f) != f {
+		return 0, errNotCoercible
+	}
+
+	return f, nil
+}
+
+// coerceInt64 converts the value to an int64, which it must be within the range of.
+func coerceInt64(value interface{}) (interface{}, error) {
+	f, err := coerceInteger(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// math.MaxInt64 rounds up to 2^63 as a float64, which is out of range
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, errNotCoercible
+	}
+
+	return int64(f), nil
+}
+
+func coerceBoolean(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseBool(v)
+	case bool:
+		return v, nil
+	}
+
+	return nil, errNotCoercible
+}
@@ -0,0 +1,165 @@
+package conflate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflicts(t *testing.T) {
+	assert.False(t, conflicts(nil, 1.0))
+	assert.False(t, conflicts(1.0, nil))
+	assert.False(t, conflicts(1.0, 2.0))
+	assert.False(t, conflicts(map[string]interface{}{}, map[string]interface{}{"a": 1}))
+	assert.True(t, conflicts(1.0, "1"))
+	assert.True(t, conflicts(int64(1), 1.0))
+	assert.True(t, conflicts(map[string]interface{}{}, "x"))
+	assert.True(t, conflicts([]interface{}{}, map[string]interface{}{}))
+}
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		types    []string
+		expected interface{}
+		ok       bool
+	}{
+		{"8080", []string{"number"}, 8080.0, true},
+		{"8080.5", []string{"integer"}, nil, false},
+		{"8080", []string{"integer"}, 8080.0, true},
+		{"8080", []string{"int64"}, int64(8080), true},
+		{8080.5, []string{"int64"}, nil, false},
+		{1e300, []string{"int64"}, nil, false},
+		{-1e300, []string{"int64"}, nil, false},
+		{float64(math.MaxInt64), []string{"int64"}, nil, false},
+		{float64(math.MinInt64), []string{"int64"}, int64(math.MinInt64), true},
+		{"Inf", []string{"number"}, nil, false},
+		{"-Inf", []string{"integer"}, nil, false},
+		{"NaN", []string{"number"}, nil, false},
+		{math.Inf(1), []string{"number"}, nil, false},
+		{8080.0, []string{"string"}, "8080", true},
+		{int64(1), []string{"string"}, "1", true},
+		{true, []string{"string"}, "true", true},
+		{"true", []string{"boolean"}, true, true},
+		{"x", []string{"boolean", "number", "string"}, "x", true},
+		{"x", []string{"number"}, nil, false},
+		{map[string]interface{}{}, []string{"string"}, nil, false},
+		{"x", []string{"object"}, nil, false},
+		{"x", nil, nil, false},
+	}
+
+	for _, test := range tests {
+		coerced, ok := coerce(test.value, test.types)
+		assert.Equal(t, test.ok, ok, test.value)
+		assert.Equal(t, test.expected, coerced, test.value)
+	}
+}
+
+func TestMerge_TypeConflictStrict(t *testing.T) {
+	for _, policy := range []TypeConflict{"", TypeConflictStrict} {
+		_, err := testMergeWith(t, merger{rules: mergeRules{typeConflict: policy}},
+			`{"port": 8080}`, `{"port": "8080"}`)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "the destination type (float64) must be the same as the source type (string)")
+	}
+}
+
+func TestMerge_TypeConflictOverride(t *testing.T) {
+	var warnings []string
+
+	data, err := testMergeWith(t, merger{rules: mergeRules{typeConflict: TypeConflictOverride}, warnings: &warnings},
+		`{"port": 8080, "db": {"host": "a"}, "tags": ["x"]}`,
+		`{"port": "8080", "db": "b", "tags": {"x": {"y": "$delete"}}}`)
+	assert.Nil(t, err)
+	assert.Nil(t, warnings)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"port": "8080", "db": "b", "tags": {"x": {}}}`)), data)
+}
+
+func TestMerge_TypeConflictWarn(t *testing.T) {
+	var warnings []string
+
+	data, err := testMergeWith(t, merger{rules: mergeRules{typeConflict: TypeConflictWarn}, warnings: &warnings},
+		`{"port": 8080}`, `{"port": "8080"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"port": "8080"}`)), data)
+	assert.Equal(t, []string{"the destination type (float64) was overridden by the source type (string) (#/port)"}, warnings)
+
+	err = merger{rules: mergeRules{typeConflict: TypeConflictWarn}}.merge(&data, map[string]interface{}{"port": 1.0})
+	assert.Nil(t, err)
+}
+
+func TestMerge_TypeConflictCoerce(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{typeConflict: TypeConflictCoerce}},
+		`{"port": 8080, "name": "x", "debug": false}`,
+		`{"port": "8081", "name": 1, "debug": "true"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"port": 8081, "name": "1", "debug": true}`)), data)
+
+	_, err = testMergeWith(t, merger{rules: mergeRules{typeConflict: TypeConflictCoerce}},
+		`{"port": 8080}`, `{"port": "high"}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the source value (high) could not be coerced to the destination type (float64) (#/port)")
+
+	_, err = testMergeWith(t, merger{rules: mergeRules{typeConflict: TypeConflictCoerce}},
+		`{"port": 8080}`, `{"port": "Inf"}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the source value (Inf) could not be coerced to the destination type (float64) (#/port)")
+}
+
+func TestMerge_TypeConflictCoerceSchema(t *testing.T) {
+	s, err := NewSchemaData([]byte(`{"properties": {"port": {"type": ["integer", "string"]}, "id": {"type": "string"}}}`))
+	assert.Nil(t, err)
+
+	rules := mergeRules{typeConflict: TypeConflictCoerce, schema: s.s}
+	data, err := testMergeWith(t, merger{rules: rules}, `{"port": "x", "id": "a"}`, `{"port": 8080, "id": 2}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"port": 8080, "id": "2"}`)), data)
+}
+
+func TestMerge_TypeConflictUnknown(t *testing.T) {
+	_, err := testMergeWith(t, merger{rules: mergeRules{typeConflict: "other"}}, `{"port": 8080}`, `{"port": "8080"}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown type conflict policy : other")
+}
+
+func TestConflate_TypeConflictWarnings(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.toml": "port = 8080\n",
+		"host/prod.yaml": "port: \"8080\"\n",
+	}, WithTypeConflict(TypeConflictWarn), WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.toml", "mem://host/prod.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"the destination type (int64) was overridden by the source type (string) (#/port at mem://host/prod.yaml:1:7)",
+	}, c.Warnings())
+	assert.Equal(t, "/port: mem://host/prod.yaml (overrides mem://host/base.toml)\n", c.Explain())
+
+	warnings := c.Warnings()
+	warnings[0] = "changed"
+	assert.NotEqual(t, "changed", c.Warnings()[0])
+}
+
+func TestConflate_TypeConflictCoerceTOML(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.toml": "port = 8080\n",
+		"host/prod.json": `{"port": 8081}`,
+	}, WithTypeConflict(TypeConflictCoerce))
+
+	err := c.AddFiles("mem://host/base.toml", "mem://host/prod.json")
+	assert.Nil(t, err)
+
+	val, err := c.Lookup("/port")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8081), val)
+
+	c = testMemConflate(map[string]string{
+		"host/base.toml": "port = 1\n",
+		"host/prod.json": `{"port": 1e300}`,
+	}, WithTypeConflict(TypeConflictCoerce))
+
+	err = c.AddFiles("mem://host/base.toml", "mem://host/prod.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not be coerced to the destination type (int64)")
+}
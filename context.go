@@ -3,20 +3,33 @@ package conflate
 import (
 	"fmt"
 	"path"
+	"strings"
 )
 
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 func rootContext() context {
-	return context("#")
+	return context{path: "#"}
 }
 
 func (c context) String() string {
-	return string(c)
+	return c.path
+}
+
+// pointer returns the context as a JSON pointer (RFC 6901), where the root is the blank string.
+func (c context) pointer() string {
+	return c.ptr
 }
 
 func (c context) add(s ...string) context {
-	return context(path.Join(c.String(), path.Join(s...)))
+	ptr := c.ptr
+	for _, p := range s {
+		ptr += "/" + pointerEscaper.Replace(p)
+	}
+
+	return context{path: path.Join(c.String(), path.Join(s...)), ptr: ptr}
 }
 
 func (c context) addInt(i int) context {
-	return context(fmt.Sprintf("%v[%v]", c.String(), i))
+	return context{path: fmt.Sprintf("%v[%v]", c.String(), i), ptr: fmt.Sprintf("%v/%v", c.ptr, i)}
 }
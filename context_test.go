@@ -24,3 +24,10 @@ func TestMakeContext_AddInt(t *testing.T) {
 	assert.Equal(t, "#", ctx.String())
 	assert.Equal(t, "#/parent[3]", ctx2.String())
 }
+
+func TestContext_Pointer(t *testing.T) {
+	ctx := rootContext()
+	assert.Equal(t, "", ctx.pointer())
+	assert.Equal(t, "/parent/child/3", ctx.add("parent", "child").addInt(3).pointer())
+	assert.Equal(t, "/a~1b/c~0d", ctx.add("a/b").add("c~d").pointer())
+}
@@ -0,0 +1,23 @@
+package conflate
+
+// deepCopy returns a copy of the given unmarshalled data, that shares no maps or slices with the original.
+func deepCopy(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = deepCopy(val)
+		}
+
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = deepCopy(val)
+		}
+
+		return s
+	default:
+		return data
+	}
+}
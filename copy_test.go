@@ -0,0 +1,109 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeepCopy(t *testing.T) {
+	data := map[string]interface{}{
+		"map":   map[string]interface{}{"x": 1},
+		"slice": []interface{}{map[string]interface{}{"y": 2}},
+		"str":   "str",
+	}
+
+	out := deepCopy(data)
+	assert.Equal(t, data, out)
+
+	outMap, ok := out.(map[string]interface{})
+	assert.True(t, ok)
+
+	outMap["map"].(map[string]interface{})["x"] = 3
+	outMap["slice"].([]interface{})[0].(map[string]interface{})["y"] = 4
+	outMap["str"] = "changed"
+
+	assert.Equal(t, 1, data["map"].(map[string]interface{})["x"])
+	assert.Equal(t, 2, data["slice"].([]interface{})[0].(map[string]interface{})["y"])
+	assert.Equal(t, "str", data["str"])
+}
+
+func TestDeepCopy_Scalar(t *testing.T) {
+	assert.Nil(t, deepCopy(nil))
+	assert.Equal(t, 1.0, deepCopy(1.0))
+}
+
+func TestMerge_SourceNotAliased(t *testing.T) {
+	first := testMergeGetData(t, []byte(`{"db": {"hosts": ["a"], "opts": {"x": 1, "y": "$delete"}}}`))
+	second := testMergeGetData(t, []byte(`{"db": {"hosts": ["b"], "opts": {"x": 2, "z": 3}}}`))
+	firstCopy := deepCopy(first)
+	secondCopy := deepCopy(second)
+
+	var data interface{}
+
+	err := mergeTo(&data, first, second)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"db": {"hosts": ["a", "b"], "opts": {"x": 2, "z": 3}}}`)), data)
+	assert.Equal(t, firstCopy, first)
+	assert.Equal(t, secondCopy, second)
+
+	err = merge(&data, map[string]interface{}{"db": map[string]interface{}{"hosts": []interface{}{"c"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, firstCopy, first)
+	assert.Equal(t, secondCopy, second)
+}
+
+func TestMerge_ConflictNotAliased(t *testing.T) {
+	from := testMergeGetData(t, []byte(`{"db": {"host": "a"}}`))
+	fromCopy := deepCopy(from)
+	data := testMergeGetData(t, []byte(`{"db": "x"}`))
+
+	err := merger{rules: mergeRules{typeConflict: TypeConflictOverride}}.merge(&data, from)
+	assert.Nil(t, err)
+
+	err = merge(&data, testMergeGetData(t, []byte(`{"db": {"port": 1}}`)))
+	assert.Nil(t, err)
+	assert.Equal(t, fromCopy, from)
+}
+
+func TestMergePatch_NotAliased(t *testing.T) {
+	patch := testMergeGetData(t, []byte(`{"hosts": ["a"], "db": {"host": "b"}}`))
+	patchCopy := deepCopy(patch)
+
+	data := merger{}.mergePatch(rootContext(), rootContext(), nil, patch)
+	data.(map[string]interface{})["hosts"].([]interface{})[0] = "changed"
+	data.(map[string]interface{})["db"].(map[string]interface{})["host"] = "changed"
+
+	assert.Equal(t, patchCopy, patch)
+}
+
+func TestJSONPatch_NotAliased(t *testing.T) {
+	var patch interface{}
+
+	err := JSONUnmarshal([]byte(`[{"op": "add", "path": "/db", "value": {"host": "a"}}]`), &patch)
+	assert.Nil(t, err)
+
+	patchCopy := deepCopy(patch)
+	data := testMergeGetData(t, []byte(`{}`))
+
+	err = merger{}.jsonPatch(&data, patch)
+	assert.Nil(t, err)
+
+	data.(map[string]interface{})["db"].(map[string]interface{})["host"] = "changed"
+	assert.Equal(t, patchCopy, patch)
+}
+
+func TestConflate_AddGoNotMutated(t *testing.T) {
+	first := map[string]interface{}{"db": map[string]interface{}{"hosts": []interface{}{"a"}}}
+	second := map[string]interface{}{"db": map[string]interface{}{"hosts": []interface{}{"b"}, "port": 1.0}}
+	firstCopy := deepCopy(first)
+	secondCopy := deepCopy(second)
+
+	c, err := FromGo(first, second)
+	assert.Nil(t, err)
+
+	err = c.AddGo(map[string]interface{}{"db": map[string]interface{}{"hosts": []interface{}{"c"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, firstCopy, first)
+	assert.Equal(t, secondCopy, second)
+}
@@ -0,0 +1,73 @@
+package conflate
+
+import (
+	"reflect"
+)
+
+// deleteMarker is the value of an object property that deletes the property from the data being overridden.
+// Within an array, an object with the marker as its only property deletes the items that equal its value,
+// or for the keyed strategy, the items whose key property equals its value.
+const deleteMarker = "$delete"
+
+// isDelete reports whether the value of an object property deletes the property.
+func (r mergeRules) isDelete(value interface{}) bool {
+	if value == nil {
+		return r.nullDeletes
+	}
+
+	s, ok := value.(string)
+
+	return ok && s == deleteMarker
+}
+
+// deleteItem returns the value of an array item that deletes items, and whether the item is such a marker.
+func deleteItem(item interface{}) (interface{}, bool) {
+	obj, ok := item.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return nil, false
+	}
+
+	val, ok := obj[deleteMarker]
+
+	return val, ok
+}
+
+// matchesDelete reports whether the array item is deleted by a marker with the given value.
+func matchesDelete(item, value interface{}, am ArrayMerge) bool {
+	if am.Strategy == ArrayKeyed {
+		obj, ok := item.(map[string]interface{})
+
+		return ok && reflect.DeepEqual(obj[am.Key], value)
+	}
+
+	return reflect.DeepEqual(item, value)
+}
+
+// stripDeletes returns a deep copy of the value without any deletion markers,
+// which have nothing to delete when there is no data being overridden.
+func (r mergeRules) stripDeletes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		props := make(map[string]interface{}, len(v))
+
+		for name, val := range v {
+			if !r.isDelete(val) {
+				props[name] = r.stripDeletes(val)
+			}
+		}
+
+		return props
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+
+		for _, item := range v {
+			if _, ok := deleteItem(item); !ok {
+				items = append(items, r.stripDeletes(item))
+			}
+		}
+
+		return items
+	}
+
+	return value
+}
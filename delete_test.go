@@ -0,0 +1,149 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeRules_IsDelete(t *testing.T) {
+	assert.True(t, mergeRules{}.isDelete("$delete"))
+	assert.False(t, mergeRules{}.isDelete("delete"))
+	assert.False(t, mergeRules{}.isDelete(nil))
+	assert.True(t, mergeRules{nullDeletes: true}.isDelete(nil))
+}
+
+func TestDeleteItem(t *testing.T) {
+	val, ok := deleteItem(map[string]interface{}{"$delete": "x"})
+	assert.True(t, ok)
+	assert.Equal(t, "x", val)
+
+	_, ok = deleteItem(map[string]interface{}{"$delete": "x", "y": 1})
+	assert.False(t, ok)
+
+	_, ok = deleteItem("$delete")
+	assert.False(t, ok)
+}
+
+func TestMerge_DeleteProperty(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{}},
+		`{"a": 1, "b": {"c": 1, "d": 2}, "e": null}`,
+		`{"a": "$delete", "b": {"c": "$delete"}, "e": "$delete", "f": "$delete"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"b": {"d": 2}}`)), data)
+}
+
+func TestMerge_NullDeletes(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{}}, `{"a": 1, "b": 2}`, `{"a": null}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": 1, "b": 2}`)), data)
+
+	data, err = testMergeWith(t, merger{rules: mergeRules{nullDeletes: true}},
+		`{"a": 1, "b": 2}`, `{"a": null, "c": {"d": null}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"b": 2, "c": {}}`)), data)
+}
+
+func TestMerge_DeleteMarkersStripped(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{}},
+		`{}`, `{"a": {"b": "$delete", "c": [1, {"$delete": 1}, {"d": "$delete"}]}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": {"c": [1, {}]}}`)), data)
+}
+
+func TestMerge_DeleteArrayItems(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{}},
+		`{"a": [1, 2, 1, 3]}`, `{"a": [{"$delete": 1}, 4]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [2, 3, 4]}`)), data)
+}
+
+func TestMerge_DeleteKeyedArrayItems(t *testing.T) {
+	data, err := testMergeWith(t, merger{rules: mergeRules{global: ArrayMerge{Strategy: ArrayKeyed, Key: "name"}}},
+		`{"a": [{"name": "x"}, {"name": "y", "v": 1}]}`,
+		`{"a": [{"$delete": "x"}, {"name": "y", "v": "$delete"}]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": [{"name": "y"}]}`)), data)
+}
+
+func TestConflate_DeleteItemProvenance(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.json": `{"tags": ["x", {"name": "y"}, "z"]}`,
+		"host/env.json":  `{"tags": [{"$delete": {"name": "y"}}]}`,
+		"host/prod.json": `{"tags": [{"$delete": "z"}]}`,
+	}, WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.json", "mem://host/env.json", "mem://host/prod.json")
+	assert.Nil(t, err)
+
+	// the item at /tags/1 has been deleted twice, and the item at /tags/0 was never deleted
+	assert.Equal(t, &Provenance{Path: "/tags/0", Source: "mem://host/base.json"}, c.Provenance("/tags/0"))
+	assert.Equal(t, &Provenance{
+		Path:       "/tags/1",
+		Source:     "mem://host/prod.json",
+		Overridden: []string{"mem://host/base.json"},
+		Deleted:    true,
+	}, c.Provenance("/tags/1"))
+	assert.Equal(t, `/tags/0: mem://host/base.json
+/tags/1: deleted by mem://host/env.json (overrides mem://host/base.json)
+/tags/1: deleted by mem://host/prod.json (overrides mem://host/base.json)
+`, c.Explain())
+
+	// the deleted items are forgotten with their array
+	err = c.AddData([]byte(`{"tags": "$delete"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "/tags: deleted by <data> (overrides mem://host/base.json, mem://host/env.json, mem://host/prod.json)\n",
+		c.Explain())
+}
+
+func TestConflate_DeleteProvenance(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.json": `{"db": {"host": "a", "port": 1}, "tags": ["x", "y", "z"]}`,
+		"host/env.json":  `{"db": {"host": "b"}}`,
+		"host/prod.json": `{"db": "$delete", "tags": [{"$delete": "x"}]}`,
+		"host/last.json": `{"db": {"port": 2}}`,
+	}, WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.json", "mem://host/env.json", "mem://host/prod.json")
+	assert.Nil(t, err)
+	assert.Equal(t, &Provenance{
+		Path:       "/db",
+		Source:     "mem://host/prod.json",
+		Overridden: []string{"mem://host/base.json", "mem://host/env.json"},
+		Deleted:    true,
+	}, c.Provenance("/db"))
+	assert.Equal(t, `/db: deleted by mem://host/prod.json (overrides mem://host/base.json, mem://host/env.json)
+/tags/0: mem://host/base.json
+/tags/0: deleted by mem://host/prod.json (overrides mem://host/base.json)
+/tags/1: mem://host/base.json
+`, c.Explain())
+
+	_, err = c.Lookup("/db")
+	assert.ErrorIs(t, err, errPointerNotFound)
+
+	val, err := c.Lookup("/tags/0")
+	assert.Nil(t, err)
+	assert.Equal(t, "y", val)
+
+	err = c.AddFiles("mem://host/last.json")
+	assert.Nil(t, err)
+	assert.Nil(t, c.Provenance("/db"))
+	assert.Equal(t, "mem://host/last.json", c.Provenance("/db/port").Source)
+}
+
+func TestConflate_DeletePositions(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.yaml": "tags:\n  - x\n  - 1\n",
+		"host/prod.yaml": "tags:\n  - $delete: x\n",
+	})
+
+	err := c.AddFiles("mem://host/base.yaml", "mem://host/prod.yaml")
+	assert.Nil(t, err)
+
+	s, err := NewSchemaData([]byte(`{"properties": {"tags": {"items": {"type": "string"}}}}`))
+	assert.Nil(t, err)
+
+	err = c.Validate(s)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "(#/tags/0 at mem://host/base.yaml:3:5)")
+}
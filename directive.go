@@ -0,0 +1,125 @@
+package conflate
+
+import (
+	"strconv"
+
+	"github.com/xeipuuv/gojsonreference"
+)
+
+const (
+	keyMerge    = "x-merge"
+	keyMergeKey = "x-merge-key"
+
+	// objectMerge merges the properties of an object into the object it overrides, which is the default.
+	objectMerge = "merge"
+	// objectReplace replaces the object it overrides.
+	objectReplace = "replace"
+
+	// maxRefs limits the number of references followed to reach a schema node, in case they are circular.
+	maxRefs = 32
+)
+
+// directive holds the merge keywords declared on a schema node.
+type directive struct {
+	merge string
+	key   string
+}
+
+// schemaDirective returns the merge keywords declared on the schema node that describes the value located by the JSON pointer.
+// It reports false if no node describes the value, or the node declares no merge keywords.
+func schemaDirective(schema interface{}, ptr string) (directive, bool) {
+	node := schemaNode(schema, ptr)
+	if node == nil {
+		return directive{}, false
+	}
+
+	var d directive
+
+	d.merge, _ = node[keyMerge].(string)
+	d.key, _ = node[keyMergeKey].(string)
+
+	return d, d.merge != "" || d.key != ""
+}
+
+// schemaNode returns the schema node that describes the value located by the JSON pointer, or nil if there is none.
+func schemaNode(schema interface{}, ptr string) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+
+	tokens, err := splitPointer(ptr)
+	if err != nil {
+		return nil
+	}
+
+	node := resolveSchemaRef(schema, schema)
+
+	for _, token := range tokens {
+		node = resolveSchemaRef(schema, schemaChild(node, token))
+		if node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// schemaChild returns the schema node that describes the property or array item named by the token.
+func schemaChild(node map[string]interface{}, token string) interface{} {
+	if node == nil {
+		return nil
+	}
+
+	if props, ok := node["properties"].(map[string]interface{}); ok {
+		if prop, ok := props[token]; ok {
+			return prop
+		}
+	}
+
+	if addProps, ok := node["additionalProperties"].(map[string]interface{}); ok {
+		return addProps
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return nil
+	}
+
+	switch items := node["items"].(type) {
+	case map[string]interface{}:
+		return items
+	case []interface{}:
+		if i >= 0 && i < len(items) {
+			return items[i]
+		}
+	}
+
+	return nil
+}
+
+// resolveSchemaRef follows any $ref on the schema node to the node it references within the root schema.
+func resolveSchemaRef(rootSchema, schema interface{}) map[string]interface{} {
+	for range maxRefs {
+		node, ok := schema.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+
+		jref, err := gojsonreference.NewJsonReference(ref)
+		if err != nil {
+			return nil
+		}
+
+		schema, _, err = jref.GetPointer().Get(rootSchema)
+		if err != nil {
+			return nil
+		}
+	}
+
+	return nil
+}
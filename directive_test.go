@@ -0,0 +1,121 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMergeSchema = `{
+  "type": "object",
+  "definitions": {
+    "server": {
+      "type": "object",
+      "properties": {
+        "ports": {"type": "array", "x-merge": "union"}
+      }
+    }
+  },
+  "properties": {
+    "allowed_origins": {"type": "array", "x-merge": "replace"},
+    "servers": {
+      "type": "array",
+      "x-merge-key": "name",
+      "items": {"$ref": "#/definitions/server"}
+    },
+    "tls": {"type": "object", "x-merge": "replace"},
+    "pair": {"type": "array", "items": [{"type": "array", "x-merge": "prepend"}]},
+    "labels": {"type": "object", "additionalProperties": {"type": "array", "x-merge": "replace"}}
+  }
+}`
+
+func testMergeSchemaGo(t *testing.T) interface{} {
+	t.Helper()
+
+	s, err := NewSchemaData([]byte(testMergeSchema))
+	assert.Nil(t, err)
+
+	return s.s
+}
+
+func TestSchemaDirective(t *testing.T) {
+	schema := testMergeSchemaGo(t)
+
+	d, ok := schemaDirective(schema, "/allowed_origins")
+	assert.True(t, ok)
+	assert.Equal(t, directive{merge: "replace"}, d)
+
+	d, ok = schemaDirective(schema, "/servers")
+	assert.True(t, ok)
+	assert.Equal(t, directive{key: "name"}, d)
+
+	d, ok = schemaDirective(schema, "/servers/3/ports")
+	assert.True(t, ok)
+	assert.Equal(t, directive{merge: "union"}, d)
+
+	d, ok = schemaDirective(schema, "/pair/0")
+	assert.True(t, ok)
+	assert.Equal(t, directive{merge: "prepend"}, d)
+
+	d, ok = schemaDirective(schema, "/labels/any")
+	assert.True(t, ok)
+	assert.Equal(t, directive{merge: "replace"}, d)
+}
+
+func TestSchemaDirective_None(t *testing.T) {
+	schema := testMergeSchemaGo(t)
+
+	for _, ptr := range []string{"", "/missing", "/pair/1", "/servers/x/ports", "invalid"} {
+		_, ok := schemaDirective(schema, ptr)
+		assert.False(t, ok, ptr)
+	}
+
+	_, ok := schemaDirective(nil, "/allowed_origins")
+	assert.False(t, ok)
+}
+
+func TestResolveSchemaRef_Circular(t *testing.T) {
+	schema := map[string]interface{}{
+		"definitions": map[string]interface{}{
+			"a": map[string]interface{}{"$ref": "#/definitions/b"},
+			"b": map[string]interface{}{"$ref": "#/definitions/a"},
+		},
+	}
+	assert.Nil(t, resolveSchemaRef(schema, map[string]interface{}{"$ref": "#/definitions/a"}))
+	assert.Nil(t, resolveSchemaRef(schema, map[string]interface{}{"$ref": "#/definitions/missing"}))
+}
+
+func TestConflate_MergeSchema(t *testing.T) {
+	s, err := NewSchemaData([]byte(testMergeSchema))
+	assert.Nil(t, err)
+
+	c := testMemConflate(map[string]string{
+		"host/base.json": `{"allowed_origins": ["a", "b"], "tls": {"cert": "x", "key": "y"},
+			"servers": [{"name": "web", "ports": [80, 443]}], "labels": {"team": ["a"]}}`,
+		"host/prod.json": `{"allowed_origins": ["c"], "tls": {"cert": "z"},
+			"servers": [{"name": "web", "ports": [443, 8443]}, {"name": "db"}], "labels": {"team": ["b"]}}`,
+	}, WithMergeSchema(s), WithPathArrayMerge("/labels/*", ArrayMerge{Strategy: ArrayAppend}))
+
+	err = c.AddFiles("mem://host/base.json", "mem://host/prod.json")
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"allowed_origins": ["c"], "tls": {"cert": "z"},
+		"servers": [{"name": "web", "ports": [80, 443, 8443]}, {"name": "db"}], "labels": {"team": ["a", "b"]}}`)), data)
+}
+
+func TestConflate_MergeSchemaUnknownObjectStrategy(t *testing.T) {
+	s, err := NewSchemaData([]byte(`{"type": "object", "properties": {"tls": {"type": "object", "x-merge": "other"}}}`))
+	assert.Nil(t, err)
+
+	c := New(WithMergeSchema(s))
+	err = c.AddData([]byte(`{"tls": {"a": 1}}`), []byte(`{"tls": {"b": 1}}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown object merge strategy : other")
+
+	c.MergeSchema(nil)
+	err = c.AddData([]byte(`{"tls": {"b": 1}}`))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,137 @@
+package conflate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	pkgurl "net/url"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// DocumentSelector reports whether a document of a YAML stream of several documents is merged,
+// given its index within the stream, counting from 0, and its data.
+type DocumentSelector func(index int, doc interface{}) bool
+
+// DocumentIndex selects the document at the index within each stream, so a stream with no document at the index
+// contributes no data.
+func DocumentIndex(i int) DocumentSelector {
+	return func(index int, _ interface{}) bool {
+		return index == i
+	}
+}
+
+// DocumentMatch selects the documents in which the value located by the JSON pointer is the given value,
+// along with those in which nothing is located by the pointer. A stream may then start with the defaults,
+// followed by a document for each profile, as in Spring configs, with DocumentMatch("/profile", "prod").
+func DocumentMatch(ptr, value string) DocumentSelector {
+	return func(_ int, doc interface{}) bool {
+		val, err := lookupPointer(doc, ptr)
+		if err != nil {
+			return true
+		}
+
+		return fmt.Sprint(val) == value
+	}
+}
+
+// isYAMLStream reports whether data with the extension may be a YAML stream of several documents.
+func isYAMLStream(ext string) bool {
+	return ext == ".yaml" || ext == ".yml" || ext == ""
+}
+
+// splitYAMLDocuments returns the root node of each document of a YAML stream, which is nil for an empty document,
+// or nil if the data is not a YAML stream of more than one document.
+func splitYAMLDocuments(data []byte) []*yamlv3.Node {
+	var docs []*yamlv3.Node
+
+	decoder := yamlv3.NewDecoder(bytes.NewReader(data))
+
+	for {
+		var doc yamlv3.Node
+
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil
+		}
+
+		var root *yamlv3.Node
+		if len(doc.Content) > 0 && doc.Content[0].ShortTag() != "!!null" {
+			root = doc.Content[0]
+		}
+
+		docs = append(docs, root)
+	}
+
+	if len(docs) < 2 {
+		return nil
+	}
+
+	return docs
+}
+
+// newFiledatas creates the filedata for each document of the data, which is merged over the previous documents.
+// Only YAML streams have more than one document, of which those chosen by the document selector are kept.
+// Each document is the given kind of patch, or not a patch if the kind is blank.
+func (l *loader) newFiledatas(data []byte, url *pkgurl.URL, patch patchKind) (filedatas, error) {
+	fd := filedata{data: data, url: url, patch: patch}
+
+	if l.expand {
+		fd.data = recursiveExpand(fd.data)
+	}
+
+	var docs []*yamlv3.Node
+
+	if isYAMLStream(fd.ext()) {
+		docs = splitYAMLDocuments(fd.data)
+	}
+
+	if docs == nil {
+		fd, err := l.parseFiledata(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		return filedatas{fd}, nil
+	}
+
+	var fdata filedatas
+
+	for i, doc := range docs {
+		if doc == nil {
+			continue
+		}
+
+		if l.documents != nil {
+			var val interface{}
+
+			err := doc.Decode(&val)
+			if err != nil {
+				return nil, fd.wrapError(fmt.Errorf("could not select document %v: %w", i, err))
+			}
+
+			if !l.documents(i, val) {
+				continue
+			}
+		}
+
+		b, err := yamlv3.Marshal(doc)
+		if err != nil {
+			return nil, fd.wrapError(fmt.Errorf("could not split document %v: %w", i, err))
+		}
+
+		docFd, err := l.parseFiledata(filedata{data: b, url: url, patch: fd.patch, document: doc})
+		if err != nil {
+			return nil, err
+		}
+
+		fdata = append(fdata, docFd)
+	}
+
+	return fdata, nil
+}
@@ -0,0 +1,176 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitYAMLDocuments(t *testing.T) {
+	assert.Nil(t, splitYAMLDocuments([]byte("a: 1\n")))
+	assert.Nil(t, splitYAMLDocuments([]byte(`{"a": 1}`)))
+	assert.Nil(t, splitYAMLDocuments([]byte("a: 1\n---\n: : [\n")))
+
+	docs := splitYAMLDocuments([]byte("a: 1\n---\n---\nb: 2\n...\n"))
+	assert.Len(t, docs, 3)
+	assert.Equal(t, 1, docs[0].Line)
+	assert.Nil(t, docs[1])
+	assert.Equal(t, 4, docs[2].Line)
+}
+
+func TestDocumentSelectors(t *testing.T) {
+	sel := DocumentIndex(1)
+	assert.False(t, sel(0, nil))
+	assert.True(t, sel(1, nil))
+
+	sel = DocumentMatch("/spring/profile", "prod")
+	assert.True(t, sel(0, map[string]interface{}{"x": 1}))
+	assert.True(t, sel(1, map[string]interface{}{"spring": map[string]interface{}{"profile": "prod"}}))
+	assert.False(t, sel(2, map[string]interface{}{"spring": map[string]interface{}{"profile": "dev"}}))
+
+	sel = DocumentMatch("/version", "2")
+	assert.True(t, sel(0, map[string]interface{}{"version": 2}))
+	assert.False(t, sel(0, map[string]interface{}{"version": 3}))
+}
+
+const testYAMLStream = `includes:
+  - common.yaml
+db:
+  host: localhost
+  port: 5432
+---
+profile: dev
+db:
+  host: dev
+---
+profile: prod
+includes:
+  - prod.yaml
+db:
+  host: prod
+`
+
+func testStreamConflate(opts ...Option) *Conflate {
+	return testMemConflate(map[string]string{
+		"host/stream.yaml": testYAMLStream,
+		"host/common.yaml": "db:\n  user: app\n  host: common\n",
+		"host/prod.yaml":   "db:\n  port: 6432\n",
+	}, opts...)
+}
+
+func TestConflate_YAMLStream(t *testing.T) {
+	c := testStreamConflate(WithProvenance(true))
+
+	err := c.AddFiles("mem://host/stream.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"profile": "prod",
+		"db":      map[string]interface{}{"host": "prod", "port": 6432.0, "user": "app"},
+	}, out)
+
+	prov := c.Provenance("/db/host")
+	assert.Equal(t, "mem://host/stream.yaml", prov.Source)
+	assert.Equal(t, []string{"mem://host/common.yaml", "mem://host/stream.yaml", "mem://host/stream.yaml"}, prov.Overridden)
+}
+
+func TestConflate_YAMLStreamSelected(t *testing.T) {
+	c := testStreamConflate(WithDocumentSelector(DocumentMatch("/profile", "dev")))
+
+	err := c.AddFiles("mem://host/stream.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"profile": "dev",
+		"db":      map[string]interface{}{"host": "dev", "port": 5432.0, "user": "app"},
+	}, out)
+
+	c = testStreamConflate(WithDocumentSelector(DocumentIndex(2)))
+
+	err = c.AddFiles("mem://host/stream.yaml")
+	assert.Nil(t, err)
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"profile": "prod",
+		"db":      map[string]interface{}{"host": "prod", "port": 6432.0},
+	}, out)
+}
+
+func TestConflate_YAMLStreamData(t *testing.T) {
+	c := New(WithDocumentSelector(DocumentIndex(5)))
+
+	err := c.AddData([]byte("a: 1\n---\nb: 2\n"), []byte("c: 3\n"))
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"c": 3.0}, out)
+
+	c.SelectDocuments(nil)
+
+	err = c.AddData([]byte("a: 1\n---\nb: 2\n"))
+	assert.Nil(t, err)
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1.0, "b": 2.0, "c": 3.0}, out)
+}
+
+func TestConflate_YAMLStreamPositions(t *testing.T) {
+	c := New()
+
+	err := c.AddData([]byte("a: 1\n---\n# the override\nb:\n  c: x\n"))
+	assert.Nil(t, err)
+
+	err = c.AddData([]byte("b:\n  c: 1\n"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "(#/b/c at 2:6)")
+
+	c = New()
+
+	err = c.AddData([]byte("b:\n  c: 1\n---\n# the override\nb:\n  c: x\n"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "(#/b/c at 6:6)")
+}
+
+func TestConflate_YAMLStreamPatches(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml":             "a: 1\nb: 2\n",
+		"host/prod.merge-patch.yaml": "a: null\n---\nc: 3\n",
+	}, WithPatchSuffixes(true))
+
+	err := c.AddFiles("mem://host/main.yaml", "mem://host/prod.merge-patch.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"b": 2.0, "c": 3.0}, out)
+}
+
+func TestConflate_YAMLStreamGraph(t *testing.T) {
+	graph, err := testStreamConflate().GraphFiles("mem://host/stream.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"mem://host/common.yaml",
+		"mem://host/prod.yaml",
+		"mem://host/stream.yaml",
+	}, graph.List())
+
+	graph, err = testStreamConflate(WithDocumentSelector(DocumentIndex(0))).GraphFiles("mem://host/stream.yaml")
+	assert.Nil(t, err)
+	assert.Len(t, graph[0].Includes, 1)
+}
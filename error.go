@@ -4,13 +4,22 @@ import (
 	"fmt"
 )
 
-type context string
+// context locates a value within the data, for use in error messages.
+type context struct {
+	path string
+	ptr  string
+}
 
 type contextError struct {
-	msg     string
-	context context
+	msg      string
+	context  context
+	position position
 }
 
 func (e contextError) Error() string {
-	return fmt.Sprintf("%v (%v)", e.msg, e.context)
+	if e.position.isZero() {
+		return fmt.Sprintf("%v (%v)", e.msg, e.context)
+	}
+
+	return fmt.Sprintf("%v (%v at %v)", e.msg, e.context, e.position)
 }
@@ -17,8 +17,8 @@ func customJSONUnmarshal(data []byte, out interface{}) error {
 }
 
 func main() {
-	// define the unmarshallers for the given file extensions, blank extension is the global unmarshaller
-	conflate.Unmarshallers = conflate.UnmarshallerMap{
+	// define the unmarshallers for the given file extensions, blank extension is the fallback unmarshaller
+	unmarshallers := conflate.UnmarshallerMap{
 		".json": conflate.UnmarshallerFuncs{customJSONUnmarshal},
 		".jsn":  conflate.UnmarshallerFuncs{conflate.JSONUnmarshal},
 		".yaml": conflate.UnmarshallerFuncs{conflate.YAMLUnmarshal},
@@ -31,8 +31,11 @@ func main() {
 	_, thisFile, _, _ := runtime.Caller(0) //nolint:dogsled // ok for an example
 	thisDir := path.Dir(thisFile)
 
+	// create a conflate instance using the custom unmarshallers
+	c := conflate.New(conflate.WithUnmarshallers(unmarshallers))
+
 	// merge multiple config files
-	c, err := conflate.FromFiles(path.Join(thisDir, "../testdata/valid_parent.json"))
+	err := c.AddFiles(path.Join(thisDir, "../testdata/valid_parent.json"))
 	if err != nil {
 		fmt.Println(err)
 
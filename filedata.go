@@ -6,13 +6,24 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 type filedata struct {
-	url      *pkgurl.URL
-	data     []byte
-	obj      map[string]interface{}
-	includes []string
+	url       *pkgurl.URL
+	data      []byte
+	obj       map[string]interface{}
+	includes  []include
+	positions locator
+	// patch is set if the data patches the merged data, in which case it is held in patchDoc rather than obj.
+	patch    patchKind
+	patchDoc interface{}
+	// items holds the includes declared within the items of arrays, which are merged under the items.
+	items []itemIncludes
+	// document is the root node of the data if it is one of several documents in a YAML stream,
+	// so that positions are located within the whole stream.
+	document *yamlv3.Node
 }
 
 var emptyFiledata = filedata{}
@@ -28,32 +39,64 @@ type UnmarshallerFuncs []UnmarshallerFunc
 // UnmarshallerMap defines the type of a map of string to UnmarshallerFuncs.
 type UnmarshallerMap map[string]UnmarshallerFuncs
 
-// Unmarshallers is a list of unmarshalling functions to be used for given file extensions.
+// Unmarshallers is the default list of unmarshalling functions to be used for given file extensions.
 // The unmarshaller slice for the blank file extension is used when no match is found.
+// It is copied when a Conflate instance is constructed, see WithUnmarshallers to configure a single instance.
 var Unmarshallers = UnmarshallerMap{
-	".json": {JSONUnmarshal},
-	".jsn":  {JSONUnmarshal},
-	".yaml": {YAMLUnmarshal},
-	".yml":  {YAMLUnmarshal},
-	".toml": {TOMLUnmarshal},
-	".tml":  {TOMLUnmarshal},
-	"":      {JSONUnmarshal, YAMLUnmarshal, TOMLUnmarshal},
+	".json":       {JSONUnmarshal},
+	".jsn":        {JSONUnmarshal},
+	".json5":      {JSON5Unmarshal},
+	".jsonc":      {JSON5Unmarshal},
+	".yaml":       {YAMLUnmarshal},
+	".yml":        {YAMLUnmarshal},
+	".toml":       {TOMLUnmarshal},
+	".tml":        {TOMLUnmarshal},
+	".hcl":        {HCLUnmarshal},
+	".env":        {DotenvUnmarshal},
+	".properties": {PropertiesUnmarshal},
+	".ini":        {INIUnmarshal},
+	"":            {JSONUnmarshal, YAMLUnmarshal, TOMLUnmarshal},
+}
+
+func (l *loader) newFiledata(data []byte, url *pkgurl.URL) (filedata, error) {
+	return l.newPatchFiledata(data, url, "")
 }
 
-func newFiledata(data []byte, url *pkgurl.URL) (filedata, error) {
-	fd := filedata{data: data, url: url}
+// newPatchFiledata creates the filedata for data which is the given kind of patch, or not a patch if the kind is blank.
+func (l *loader) newPatchFiledata(data []byte, url *pkgurl.URL, patch patchKind) (filedata, error) {
+	if l.expand {
+		data = recursiveExpand(data)
+	}
+
+	return l.parseFiledata(filedata{data: data, url: url, patch: patch})
+}
+
+// parseFiledata unmarshals the data, whose variables have already been expanded, and extracts its includes.
+func (l *loader) parseFiledata(fd filedata) (filedata, error) {
+	if fd.patch != "" {
+		err := fd.unmarshalPatch(l.unmarshallers)
+		if err != nil {
+			return emptyFiledata, err
+		}
+
+		fd.positions = fd.lazyPositions()
+
+		return fd, nil
+	}
 
-	err := fd.unmarshal()
+	err := fd.unmarshal(l.unmarshallers)
 	if err != nil {
 		return emptyFiledata, err
 	}
 
-	err = fd.validate()
+	fd.positions = fd.lazyPositions()
+
+	err = fd.validate(l.includes)
 	if err != nil {
 		return emptyFiledata, err
 	}
 
-	err = fd.extractIncludes()
+	err = fd.extractIncludes(l.includes, l.nestedIncludes)
 	if err != nil {
 		return emptyFiledata, err
 	}
@@ -61,8 +104,26 @@ func newFiledata(data []byte, url *pkgurl.URL) (filedata, error) {
 	return fd, nil
 }
 
-func newExpandedFiledata(data []byte, url *pkgurl.URL) (filedata, error) {
-	return newFiledata(recursiveExpand(data), url)
+// lazyPositions returns the positions of the values within the data, which are only located if one is needed.
+// The root node of a document of a YAML stream is reused, rather than parsing the stream again.
+func (fd *filedata) lazyPositions() *lazyPositions {
+	src := filedata{url: fd.url, data: fd.data, patch: fd.patch, document: fd.document}
+
+	return newLazyPositions(src.locatePositions)
+}
+
+func (fd *filedata) locatePositions() positions {
+	switch {
+	case fd.document != nil:
+		pos := positions{}
+		pos.locateYAMLNode(rootContext(), fd.positionSource(), fd.document)
+
+		return pos
+	case fd.patch == jsonPatch:
+		return locateSequencePositions(fd.data, fd.positionSource())
+	default:
+		return locatePositions(fd.data, fd.positionSource(), fd.ext())
+	}
 }
 
 func (fd *filedata) wrapError(err error) error {
@@ -73,22 +134,28 @@ func (fd *filedata) wrapError(err error) error {
 	return fmt.Errorf("error processing %v: %w", fd.url.String(), err)
 }
 
-func (fd *filedata) validate() error {
-	return fd.wrapError(validate(fd.obj, getSchema()))
+func (fd *filedata) validate(includes string) error {
+	return fd.wrapError(validateAt(fd.obj, getSchema(includes), fd.positions))
 }
 
-func (fd *filedata) unmarshal() error {
-	ext := strings.ToLower(filepath.Ext(fd.url.Path))
+func (fd *filedata) unmarshal(unmarshallerMap UnmarshallerMap) error {
+	return fd.unmarshalTo(unmarshallerMap, &fd.obj)
+}
+
+func (fd *filedata) unmarshalPatch(unmarshallerMap UnmarshallerMap) error {
+	return fd.wrapError(fd.unmarshalTo(unmarshallerMap, &fd.patchDoc))
+}
 
-	unmarshallers, ok := Unmarshallers[ext]
+func (fd *filedata) unmarshalTo(unmarshallerMap UnmarshallerMap, out interface{}) error {
+	unmarshallers, ok := unmarshallerMap[fd.ext()]
 	if !ok {
-		unmarshallers = Unmarshallers[""]
+		unmarshallers = unmarshallerMap[""]
 	}
 
 	var err error
 
 	for _, unmarshal := range unmarshallers {
-		uerr := unmarshal(fd.data, &fd.obj)
+		uerr := unmarshal(fd.data, out)
 		if uerr == nil {
 			return nil
 		}
@@ -99,19 +166,44 @@ func (fd *filedata) unmarshal() error {
 	return err
 }
 
-func (fd *filedata) extractIncludes() error {
-	if Includes == "" {
+// extractIncludes extracts the includes array at the root, unless the includes key is blank, and if nested is set,
+// the includes declared by the include directive in any object or by the includes key in any nested object.
+func (fd *filedata) extractIncludes(includes string, nested bool) error {
+	if includes != "" {
+		err := jsonMarshalUnmarshal(fd.obj[includes], &fd.includes)
+		if err != nil {
+			return fmt.Errorf("could not extract includes: %w", err)
+		}
+
+		delete(fd.obj, includes)
+	}
+
+	if !nested {
 		return nil
 	}
 
-	err := jsonMarshalUnmarshal(fd.obj[Includes], &fd.includes)
-	if err != nil {
-		return fmt.Errorf("could not extract includes: %w", err)
+	return fd.extractNestedIncludes(rootContext(), fd.obj, []string{includeDirective}, includes)
+}
+
+func (fd *filedata) ext() string {
+	return strings.ToLower(filepath.Ext(fd.url.Path))
+}
+
+// positionSource names the source in positions, preferring the path for files.
+func (fd *filedata) positionSource() string {
+	if fd.url != nil && fd.url.Scheme == "file" {
+		return fd.url.Path
 	}
 
-	delete(fd.obj, Includes)
+	return fd.source()
+}
+
+func (fd *filedata) source() string {
+	if fd.url == nil || *fd.url == emptyURL {
+		return ""
+	}
 
-	return nil
+	return fd.url.String()
 }
 
 func (fds filedatas) objs() []interface{} {
@@ -125,7 +217,7 @@ func (fds filedatas) objs() []interface{} {
 }
 
 func (fd *filedata) isEmpty() bool {
-	return fd == nil || fd.obj == nil
+	return fd == nil || (fd.obj == nil && fd.patch == "")
 }
 
 func recursiveExpand(b []byte) []byte {
@@ -161,18 +253,13 @@ func expand(b []byte) (result []byte, count int) {
 
 var getSchema = getDefaultSchema
 
-func getDefaultSchema() map[string]interface{} {
+func getDefaultSchema(includes string) map[string]interface{} {
 	return map[string]interface{}{
 		"anyOf": []interface{}{
 			map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					Includes: map[string]interface{}{
-						"type": "array",
-						"items": map[string]interface{}{
-							"type": "string",
-						},
-					},
+					includes: includesSchema(),
 				},
 			},
 			map[string]interface{}{
@@ -181,3 +268,30 @@ func getDefaultSchema() map[string]interface{} {
 		},
 	}
 }
+
+// includesSchema returns the schema of an includes array, which is also used to validate the includes declared
+// by the include directive and by nested includes arrays.
+func includesSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{
+					"type": "string",
+				},
+				map[string]interface{}{
+					"type":     "object",
+					"required": []interface{}{"path"},
+					"properties": map[string]interface{}{
+						"path":     map[string]interface{}{"type": "string"},
+						"optional": map[string]interface{}{"type": "boolean"},
+						"if":       map[string]interface{}{"type": "string"},
+						"at":       map[string]interface{}{"type": "string"},
+						"patch":    map[string]interface{}{"enum": []interface{}{"merge", "json"}},
+					},
+					"additionalProperties": false,
+				},
+			},
+		},
+	}
+}
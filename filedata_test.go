@@ -16,7 +16,7 @@ func testFiledataNew(t *testing.T, data []byte, path string) (filedata, error) {
 	url, err := pkgurl.Parse(path)
 	assert.Nil(t, err)
 
-	return newFiledata(data, url)
+	return testLoader.newFiledata(data, url)
 }
 
 func testFiledataNewAssert(t *testing.T, data []byte, path string) filedata {
@@ -168,14 +168,14 @@ func TestFiledata_NullIncludes(t *testing.T) {
 func TestFiledata_Includes(t *testing.T) {
 	fd, err := testLoader.wrapFiledata([]byte(`{"includes":["test1", "test2"], "x": 1}`))
 	assert.Nil(t, err)
-	assert.Equal(t, fd.includes, []string{"test1", "test2"})
+	assert.Equal(t, fd.includes, []include{{path: "test1"}, {path: "test2"}})
 	assert.Nil(t, fd.obj[Includes])
 	assert.Equal(t, fd.obj, map[string]interface{}{"x": 1.0})
 }
 
 func TestFiledata_ExtractError(t *testing.T) {
 	old := getSchema
-	getSchema = func() map[string]interface{} { return map[string]interface{}{} }
+	getSchema = func(string) map[string]interface{} { return map[string]interface{}{} }
 
 	defer func() { getSchema = old }()
 
@@ -216,9 +216,10 @@ func TestFiledatas_DifferentIncludes(t *testing.T) {
 
 	defer func() { Includes = old }()
 
-	fd, err := testLoader.wrapFiledata([]byte(`{"use":["test1", "test2"], "x": 1}`))
+	l := newLoader()
+	fd, err := l.wrapFiledata([]byte(`{"use":["test1", "test2"], "x": 1}`))
 	assert.Nil(t, err)
-	assert.Equal(t, fd.includes, []string{"test1", "test2"})
+	assert.Equal(t, fd.includes, []include{{path: "test1"}, {path: "test2"}})
 	assert.Nil(t, fd.obj[Includes])
 	assert.Equal(t, fd.obj, map[string]interface{}{"x": 1.0})
 }
@@ -229,7 +230,8 @@ func TestFiledatas_NoIncludes(t *testing.T) {
 
 	defer func() { Includes = old }()
 
-	fd, err := testLoader.wrapFiledata([]byte(`{"includes":["test1", "test2"]}`))
+	l := newLoader()
+	fd, err := l.wrapFiledata([]byte(`{"includes":["test1", "test2"]}`))
 	assert.Nil(t, err)
 	assert.Empty(t, fd.includes)
 	assert.Equal(t, fd.obj, map[string]interface{}{"includes": []interface{}{"test1", "test2"}})
@@ -241,8 +243,45 @@ func TestFiledatas_IgnoreIncludes(t *testing.T) {
 
 	defer func() { Includes = old }()
 
-	fd, err := testLoader.wrapFiledata([]byte(`{"":["test1", "test2"]}`))
+	l := newLoader()
+	fd, err := l.wrapFiledata([]byte(`{"":["test1", "test2"]}`))
 	assert.Nil(t, err)
 	assert.Empty(t, fd.includes)
 	assert.Equal(t, fd.obj, map[string]interface{}{"": []interface{}{"test1", "test2"}})
 }
+
+func TestFiledata_LoaderIncludes(t *testing.T) {
+	l := newLoader()
+	l.includes = "use"
+
+	fd, err := l.wrapFiledata([]byte(`{"use":["test1"], "includes": ["test2"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, fd.includes, []include{{path: "test1"}})
+	assert.Equal(t, fd.obj, map[string]interface{}{"includes": []interface{}{"test2"}})
+	assert.Equal(t, Includes, "includes")
+}
+
+func TestFiledata_LoaderUnmarshallers(t *testing.T) {
+	l := newLoader()
+	l.unmarshallers = UnmarshallerMap{"": {YAMLUnmarshal}}
+
+	fd, err := l.wrapFiledata(testMarshalYAML)
+	assert.Nil(t, err)
+	assert.Equal(t, fd.obj, testMarshalData)
+
+	l.unmarshallers = UnmarshallerMap{"": {TOMLUnmarshal}}
+
+	_, err = l.wrapFiledata(testMarshalYAML)
+	assert.NotNil(t, err)
+}
+
+func TestFiledata_LoaderExpand(t *testing.T) {
+	t.Setenv("X", "123")
+
+	l := newLoader()
+	l.expand = true
+
+	fd, err := l.wrapFiledata([]byte(`{"x": $X}`))
+	assert.Nil(t, err)
+	assert.Equal(t, fd.obj, map[string]interface{}{"x": 123.0})
+}
@@ -0,0 +1,573 @@
+package conflate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	// dotenvSeparator separates the keys of nested objects in a dotenv key, as in DB__HOST.
+	dotenvSeparator = "__"
+	// propertiesSeparator separates the keys of nested objects in a properties key, as in db.host.
+	propertiesSeparator = "."
+)
+
+var (
+	errFlatConflict   = errors.New("the key conflicts with another key")
+	errFlatKey        = errors.New("the key cannot be written as a flat key")
+	errFlatNotObject  = errors.New("the data must be an object")
+	errDotenvLine     = errors.New("the line is not a valid dotenv assignment")
+	errDotenvQuote    = errors.New("the quoted value is not terminated")
+	errPropertiesUTF  = errors.New("the unicode escape is not valid")
+	errUnsupportedVal = errors.New("the value cannot be written as a flat value")
+)
+
+// flatEntry is a key and value read from a flat format, with the position of the value.
+type flatEntry struct {
+	keys  []string
+	value string
+	// quoted is set if the value was quoted, in which case it is always a string.
+	quoted bool
+	line   int
+	column int
+}
+
+// DotenvUnmarshal unmarshals the data as a dotenv file of KEY=value lines.
+// Keys are lower cased and nested at each double underscore, so that DB__HOST=localhost is {"db": {"host": "localhost"}},
+// and objects whose keys are 0, 1, 2... become arrays. All values are strings, see NewDotenvUnmarshaller to detect
+// numbers and booleans.
+func DotenvUnmarshal(data []byte, out interface{}) error {
+	return unmarshalDotenv(data, out, false)
+}
+
+// NewDotenvUnmarshaller returns a function that unmarshals dotenv files as DotenvUnmarshal does.
+// If typed is true then unquoted values which are JSON numbers or booleans are unmarshalled as such.
+func NewDotenvUnmarshaller(typed bool) UnmarshallerFunc {
+	return func(data []byte, out interface{}) error {
+		return unmarshalDotenv(data, out, typed)
+	}
+}
+
+func unmarshalDotenv(data []byte, out interface{}, typed bool) error {
+	entries, err := parseDotenv(data)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as dotenv: %w", err)
+	}
+
+	err = unmarshalFlat(entries, typed, out)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as dotenv: %w", err)
+	}
+
+	return nil
+}
+
+// PropertiesUnmarshal unmarshals the data as a Java properties file.
+// Keys are nested at each dot, so that db.host=localhost is {"db": {"host": "localhost"}},
+// and objects whose keys are 0, 1, 2... become arrays. All values are strings, see NewPropertiesUnmarshaller
+// to detect numbers and booleans.
+func PropertiesUnmarshal(data []byte, out interface{}) error {
+	return unmarshalProperties(data, out, false)
+}
+
+// NewPropertiesUnmarshaller returns a function that unmarshals properties files as PropertiesUnmarshal does.
+// If typed is true then values which are JSON numbers or booleans are unmarshalled as such.
+func NewPropertiesUnmarshaller(typed bool) UnmarshallerFunc {
+	return func(data []byte, out interface{}) error {
+		return unmarshalProperties(data, out, typed)
+	}
+}
+
+func unmarshalProperties(data []byte, out interface{}, typed bool) error {
+	entries, err := parseProperties(data)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as properties: %w", err)
+	}
+
+	err = unmarshalFlat(entries, typed, out)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as properties: %w", err)
+	}
+
+	return nil
+}
+
+func unmarshalFlat(entries []flatEntry, typed bool, out interface{}) error {
+	obj, err := nestFlat(entries, typed)
+	if err != nil {
+		return err
+	}
+
+	return jsonMarshalUnmarshal(obj, out)
+}
+
+// nestFlat builds the object described by the flat entries, detecting numbers and booleans in unquoted values
+// if typed is true.
+func nestFlat(entries []flatEntry, typed bool) (interface{}, error) {
+	obj := map[string]interface{}{}
+
+	for _, entry := range entries {
+		parent := obj
+		ctx := rootContext()
+
+		for i, key := range entry.keys {
+			ctx = ctx.add(key)
+
+			if i == len(entry.keys)-1 {
+				if _, ok := parent[key].(map[string]interface{}); ok {
+					return nil, fmt.Errorf("%w : %v", errFlatConflict, ctx)
+				}
+
+				parent[key] = iniValue(iniEntry{value: entry.value, quoted: entry.quoted}, typed)
+
+				break
+			}
+
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return nil, fmt.Errorf("%w : %v", errFlatConflict, ctx)
+				}
+
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+
+			parent = child
+		}
+	}
+
+	return flatArrays(obj), nil
+}
+
+// flatArrays replaces the objects whose keys are the indexes of an array with arrays.
+func flatArrays(value interface{}) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	for name, val := range obj {
+		obj[name] = flatArrays(val)
+	}
+
+	if len(obj) == 0 {
+		return obj
+	}
+
+	items := make([]interface{}, len(obj))
+
+	for i := range items {
+		item, ok := obj[strconv.Itoa(i)]
+		if !ok {
+			return obj
+		}
+
+		items[i] = item
+	}
+
+	return items
+}
+
+// locateFlatPositions finds the positions of the values read from a flat format.
+func locateFlatPositions(entries []flatEntry, err error, source string) positions {
+	if err != nil {
+		return nil
+	}
+
+	pos := positions{"": {source: source, line: 1, column: 1}}
+
+	for _, entry := range entries {
+		pos[rootContext().add(entry.keys...).pointer()] = position{source: source, line: entry.line, column: entry.column}
+	}
+
+	return pos
+}
+
+// parseDotenv reads the assignments of a dotenv file, which may be preceded by export.
+// Values may be single quoted to be read literally, or double quoted to allow escapes such as \n,
+// otherwise any comment after a space and # is removed.
+func parseDotenv(data []byte) ([]flatEntry, error) {
+	var entries []flatEntry
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(trimmed, "export "); ok {
+			trimmed = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		}
+
+		key, value, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+
+		if !ok || key == "" || strings.ContainsFunc(key, unicode.IsSpace) {
+			return nil, fmt.Errorf("%w : line %v", errDotenvLine, lineNo)
+		}
+
+		trimmedValue := strings.TrimLeftFunc(value, unicode.IsSpace)
+		column := len(line) - len(trimmedValue) + 1
+
+		value, err := dotenvValue(trimmedValue)
+		if err != nil {
+			return nil, fmt.Errorf("%w : line %v", err, lineNo)
+		}
+
+		entries = append(entries, flatEntry{
+			keys:   strings.Split(strings.ToLower(key), dotenvSeparator),
+			value:  value,
+			quoted: strings.HasPrefix(trimmedValue, "'") || strings.HasPrefix(trimmedValue, `"`),
+			line:   lineNo,
+			column: column,
+		})
+	}
+
+	return entries, nil
+}
+
+func dotenvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errDotenvQuote
+		}
+
+		return value[1 : end+1], nil
+	case strings.HasPrefix(value, `"`):
+		var sb strings.Builder
+
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return sb.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+
+				switch value[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(value[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+
+		return "", errDotenvQuote
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// parseProperties reads the properties of a Java properties file, following the rules of java.util.Properties.
+func parseProperties(data []byte) ([]flatEntry, error) {
+	var entries []flatEntry
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := lines[i]
+
+		trimmed := strings.TrimLeft(line, " \t\f")
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+
+		// join any continuation lines, which end with an odd number of backslashes
+		logical := trimmed
+		for propertiesContinues(logical) && i+1 < len(lines) {
+			i++
+			logical = logical[:len(logical)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		keyEnd := propertiesKeyEnd(logical)
+		valueStart := keyEnd
+
+		for valueStart < len(logical) && (logical[valueStart] == ' ' || logical[valueStart] == '\t' || logical[valueStart] == '\f') {
+			valueStart++
+		}
+
+		if valueStart < len(logical) && (logical[valueStart] == '=' || logical[valueStart] == ':') {
+			valueStart++
+
+			for valueStart < len(logical) && (logical[valueStart] == ' ' || logical[valueStart] == '\t' || logical[valueStart] == '\f') {
+				valueStart++
+			}
+		}
+
+		key, err := propertiesUnescape(logical[:keyEnd])
+		if err != nil {
+			return nil, fmt.Errorf("%w : line %v", err, lineNo)
+		}
+
+		value, err := propertiesUnescape(strings.TrimSuffix(logical[valueStart:], `\`))
+		if err != nil {
+			return nil, fmt.Errorf("%w : line %v", err, lineNo)
+		}
+
+		column := indent + valueStart + 1
+		if valueStart > len(trimmed) {
+			column = indent + len(trimmed) + 1
+		}
+
+		entries = append(entries, flatEntry{
+			keys:   strings.Split(key, propertiesSeparator),
+			value:  value,
+			line:   lineNo,
+			column: column,
+		})
+	}
+
+	return entries, nil
+}
+
+func propertiesContinues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+
+	return n%2 == 1
+}
+
+// propertiesKeyEnd returns the index of the first unescaped separator in the line, which ends the key.
+func propertiesKeyEnd(line string) int {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':', ' ', '\t', '\f':
+			return i
+		}
+	}
+
+	return len(line)
+}
+
+func propertiesUnescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var (
+		sb    strings.Builder
+		units []uint16
+	)
+
+	flush := func() {
+		sb.WriteString(string(utf16.Decode(units)))
+		units = nil
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			flush()
+			sb.WriteByte(s[i])
+
+			continue
+		}
+
+		i++
+
+		if s[i] == 'u' {
+			if i+5 > len(s) {
+				return "", errPropertiesUTF
+			}
+
+			u, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", errPropertiesUTF
+			}
+
+			units = append(units, uint16(u))
+			i += 4
+
+			continue
+		}
+
+		flush()
+
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+
+	flush()
+
+	return sb.String(), nil
+}
+
+// flatten calls fn with the keys and value of each scalar in the data, in key order.
+func flatten(data interface{}, keys []string, fn func(keys []string, value string) error) error {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			err := flatten(v[name], append(keys[:len(keys):len(keys)], name), fn)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case []interface{}:
+		for i, item := range v {
+			err := flatten(item, append(keys[:len(keys):len(keys)], strconv.Itoa(i)), fn)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case string:
+		return fn(keys, v)
+	case float64:
+		return fn(keys, strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		return fn(keys, strconv.FormatBool(v))
+	case nil:
+		return fn(keys, "")
+	default:
+		return fmt.Errorf("%w : %T", errUnsupportedVal, data)
+	}
+}
+
+func flatMarshal(in interface{}, format string, write func(buf *bytes.Buffer, keys []string, value string) error) ([]byte, error) {
+	var data interface{}
+
+	err := jsonMarshalUnmarshal(in, &data)
+	if err != nil {
+		return nil, fmt.Errorf("the data could not be marshalled to %v: %w", format, err)
+	}
+
+	if _, ok := data.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("the data could not be marshalled to %v: %w", format, errFlatNotObject)
+	}
+
+	var buf bytes.Buffer
+
+	err = flatten(data, nil, func(keys []string, value string) error {
+		return write(&buf, keys, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("the data could not be marshalled to %v: %w", format, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func dotenvMarshal(in interface{}) ([]byte, error) {
+	return flatMarshal(in, "dotenv", func(buf *bytes.Buffer, keys []string, value string) error {
+		for _, key := range keys {
+			// a key which starts or ends with an underscore would run into the separator
+			if key == "" || strings.Contains("_"+key+"_", dotenvSeparator) ||
+				strings.ContainsAny(key, "=#'\"") || strings.ContainsFunc(key, unicode.IsSpace) {
+				return fmt.Errorf("%w : %v", errFlatKey, key)
+			}
+		}
+
+		buf.WriteString(strings.ToUpper(strings.Join(keys, dotenvSeparator)))
+		buf.WriteString("=")
+		buf.WriteString(dotenvQuote(value))
+		buf.WriteString("\n")
+
+		return nil
+	})
+}
+
+// dotenvQuote double quotes the value if it would not otherwise be read back the same.
+func dotenvQuote(value string) string {
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#'\"\\\n\r\t") {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+		return `"` + r.Replace(value) + `"`
+	}
+
+	return value
+}
+
+func propertiesMarshal(in interface{}) ([]byte, error) {
+	return flatMarshal(in, "properties", func(buf *bytes.Buffer, keys []string, value string) error {
+		for _, key := range keys {
+			if key == "" || strings.Contains(key, propertiesSeparator) {
+				return fmt.Errorf("%w : %v", errFlatKey, key)
+			}
+		}
+
+		buf.WriteString(propertiesEscape(strings.Join(keys, propertiesSeparator), true))
+		buf.WriteString("=")
+		buf.WriteString(propertiesEscape(value, false))
+		buf.WriteString("\n")
+
+		return nil
+	})
+}
+
+// propertiesEscape escapes the special characters of a key or value, and any characters that are not printable ASCII.
+func propertiesEscape(s string, isKey bool) string {
+	var sb strings.Builder
+
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\f':
+			sb.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			sb.WriteString(`\ `)
+		case strings.ContainsRune("=:#!", r) && (isKey || i == 0):
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < ' ' || r > '~':
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&sb, `\u%04x`, u)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
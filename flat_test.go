@@ -0,0 +1,264 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDotenv = `# database
+DB__HOST=localhost
+export DB__PORT = 5432
+DB__NAME='my app' # not a comment here
+DB__PASSWORD="p#ss\n\"word\""
+TAGS__0=a
+TAGS__1=b # a comment
+EMPTY=
+`
+
+func TestDotenvUnmarshal(t *testing.T) {
+	var out interface{}
+
+	err := DotenvUnmarshal([]byte(testDotenv), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{
+			"host":     "localhost",
+			"port":     "5432",
+			"name":     "my app",
+			"password": "p#ss\n\"word\"",
+		},
+		"tags":  []interface{}{"a", "b"},
+		"empty": "",
+	}, out)
+}
+
+func TestDotenvUnmarshal_Typed(t *testing.T) {
+	var out interface{}
+
+	err := NewDotenvUnmarshaller(true)([]byte("A=1.5e3\nB=TRUE\nC=\"2\"\nD='false'\nE=-3 # comment\nF=0755\nG=x\n"), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": 1500.0,
+		"b": true,
+		"c": "2",
+		"d": "false",
+		"e": -3.0,
+		"f": "0755",
+		"g": "x",
+	}, out)
+
+	err = NewDotenvUnmarshaller(false)([]byte("A=1\n"), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "1"}, out)
+}
+
+func TestDotenvUnmarshal_Error(t *testing.T) {
+	for _, data := range []string{
+		"DB",
+		"=x",
+		"A B=x",
+		"A='x",
+		`A="x`,
+		"DB=x\nDB__HOST=y",
+		"DB__HOST=y\nDB=x",
+	} {
+		var out interface{}
+
+		err := DotenvUnmarshal([]byte(data), &out)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "dotenv", data)
+	}
+}
+
+const testProperties = `# database
+! also a comment
+db.host = localhost
+db.port:5432
+db.name   my app
+db.url=jdbc:postgresql://localhost\
+       /app
+key\ with\ spaces\=x = caf\u00e9 \ud83d\ude00
+tags.0=a
+tags.1=\ b
+empty
+`
+
+func TestPropertiesUnmarshal(t *testing.T) {
+	var out interface{}
+
+	err := PropertiesUnmarshal([]byte(testProperties), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"port": "5432",
+			"name": "my app",
+			"url":  "jdbc:postgresql://localhost/app",
+		},
+		"key with spaces=x": "café 😀",
+		"tags":              []interface{}{"a", " b"},
+		"empty":             "",
+	}, out)
+}
+
+func TestPropertiesUnmarshal_Typed(t *testing.T) {
+	var out interface{}
+
+	err := NewPropertiesUnmarshaller(true)([]byte("db.port=5432\ndb.ssl:false\ndb.host localhost\ntags.0=1\n"), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"db":   map[string]interface{}{"port": 5432.0, "ssl": false, "host": "localhost"},
+		"tags": []interface{}{1.0},
+	}, out)
+}
+
+func TestPropertiesUnmarshal_Error(t *testing.T) {
+	for _, data := range []string{`a=\u12`, `a=\uzzzz`, "a=1\na.b=2"} {
+		var out interface{}
+
+		err := PropertiesUnmarshal([]byte(data), &out)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "properties", data)
+	}
+}
+
+func TestFlatArrays(t *testing.T) {
+	assert.Equal(t, []interface{}{"a", map[string]interface{}{}}, flatArrays(map[string]interface{}{"0": "a", "1": map[string]interface{}{}}))
+	assert.Equal(t, map[string]interface{}{"0": "a", "2": "b"}, flatArrays(map[string]interface{}{"0": "a", "2": "b"}))
+	assert.Equal(t, map[string]interface{}{"1": "a"}, flatArrays(map[string]interface{}{"1": "a"}))
+}
+
+func TestLocateFlatPositions(t *testing.T) {
+	pos := locatePositions([]byte(testDotenv), "x.env", ".env")
+	assert.Equal(t, position{source: "x.env", line: 2, column: 10}, pos["/db/host"])
+	assert.Equal(t, position{source: "x.env", line: 3, column: 19}, pos["/db/port"])
+	assert.Equal(t, position{source: "x.env", line: 7, column: 9}, pos["/tags/1"])
+
+	pos = locatePositions([]byte(testProperties), "x.properties", ".properties")
+	assert.Equal(t, position{source: "x.properties", line: 3, column: 11}, pos["/db/host"])
+	assert.Equal(t, position{source: "x.properties", line: 4, column: 9}, pos["/db/port"])
+	assert.Equal(t, position{source: "x.properties", line: 5, column: 11}, pos["/db/name"])
+	assert.Equal(t, position{source: "x.properties", line: 10, column: 8}, pos["/tags/1"])
+
+	assert.Nil(t, locatePositions([]byte("A"), "x.env", ".env"))
+}
+
+var testFlatData = map[string]interface{}{
+	"db": map[string]interface{}{
+		"host":     "localhost",
+		"port":     5432.0,
+		"ssl":      true,
+		"password": " p#ss\n\"word\"",
+		"none":     nil,
+	},
+	"tags": []interface{}{"a", "é"},
+}
+
+func TestDotenvMarshal(t *testing.T) {
+	out, err := dotenvMarshal(testFlatData)
+	assert.Nil(t, err)
+	assert.Equal(t, `DB__HOST=localhost
+DB__NONE=
+DB__PASSWORD=" p#ss\n\"word\""
+DB__PORT=5432
+DB__SSL=true
+TAGS__0=a
+TAGS__1=é
+`, string(out))
+
+	var back interface{}
+
+	err = DotenvUnmarshal(out, &back)
+	assert.Nil(t, err)
+	assert.Equal(t, " p#ss\n\"word\"", back.(map[string]interface{})["db"].(map[string]interface{})["password"])
+}
+
+func TestPropertiesMarshal(t *testing.T) {
+	out, err := propertiesMarshal(testFlatData)
+	assert.Nil(t, err)
+	assert.Equal(t, `db.host=localhost
+db.none=
+db.password=\ p#ss\n"word"
+db.port=5432
+db.ssl=true
+tags.0=a
+tags.1=\u00e9
+`, string(out))
+
+	var back interface{}
+
+	err = PropertiesUnmarshal(out, &back)
+	assert.Nil(t, err)
+	assert.Equal(t, " p#ss\n\"word\"", back.(map[string]interface{})["db"].(map[string]interface{})["password"])
+	assert.Equal(t, []interface{}{"a", "é"}, back.(map[string]interface{})["tags"])
+
+	out, err = propertiesMarshal(map[string]interface{}{"a b=:#!": "#x", "c": "😀"})
+	assert.Nil(t, err)
+	assert.Equal(t, "a\\ b\\=\\:\\#\\!=\\#x\nc=\\ud83d\\ude00\n", string(out))
+}
+
+func TestFlatMarshal_Error(t *testing.T) {
+	for _, data := range []interface{}{
+		[]interface{}{"a"},
+		map[string]interface{}{"a__b": 1},
+		map[string]interface{}{"_a": 1},
+		map[string]interface{}{"a b": 1},
+		map[string]interface{}{"": 1},
+		map[string]interface{}{"a": func() {}},
+	} {
+		_, err := dotenvMarshal(data)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "the data could not be marshalled to dotenv")
+	}
+
+	for _, data := range []interface{}{"a", map[string]interface{}{"a.b": 1}, map[string]interface{}{"a": map[string]interface{}{"": 1}}} {
+		_, err := propertiesMarshal(data)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "the data could not be marshalled to properties")
+	}
+}
+
+func TestConflate_Dotenv(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml":      "includes:\n  - app.properties\n  - .env\ndb:\n  port: 5432\n  host: yaml\n",
+		"host/app.properties": "db.host=props\ndb.user=app\n",
+		"host/.env":           "DB__PORT=6543\nDB__USER=env\n",
+	}, WithDotenvTypes(true), WithPropertiesTypes(true))
+
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+
+	out, err := c.MarshalDotenv()
+	assert.Nil(t, err)
+	assert.Equal(t, "DB__HOST=yaml\nDB__PORT=5432\nDB__USER=env\n", string(out))
+
+	out, err = c.MarshalProperties()
+	assert.Nil(t, err)
+	assert.Equal(t, "db.host=yaml\ndb.port=5432\ndb.user=env\n", string(out))
+}
+
+func TestConflate_DotenvTypes(t *testing.T) {
+	files := map[string]string{
+		"host/base.yaml":       "db:\n  port: 5432\n  ssl: true\n",
+		"host/prod.env":        "DB__PORT=5433\n",
+		"host/prod.properties": "db.ssl=false\n",
+	}
+
+	for _, file := range []string{"mem://host/prod.env", "mem://host/prod.properties"} {
+		c := testMemConflate(files)
+		err := c.AddFiles("mem://host/base.yaml", file)
+		assert.NotNil(t, err, file)
+		assert.Contains(t, err.Error(), "must be the same as the source type (string)", file)
+	}
+
+	c := testMemConflate(files, WithDotenvTypes(true), WithPropertiesTypes(true))
+	err := c.AddFiles("mem://host/base.yaml", "mem://host/prod.env", "mem://host/prod.properties")
+	assert.Nil(t, err)
+
+	var data interface{}
+
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"db": map[string]interface{}{"port": 5433.0, "ssl": false}}, data)
+}
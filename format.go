@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/xeipuuv/gojsonschema"
 	"golang.org/x/net/html"
@@ -19,40 +20,53 @@ var (
 	errUnsupportedType = errors.New("called with unsupported type")
 )
 
-func initFormatCheckers() {
-	// annoyingly the format checker list is a global variable
-	gojsonschema.FormatCheckers.Add(newXMLFormatChecker("xml"))
-	gojsonschema.FormatCheckers.Add(newXMLTemplateFormatChecker("xml-template"))
-	gojsonschema.FormatCheckers.Add(newHTMLFormatChecker("html-template"))
-	gojsonschema.FormatCheckers.Add(newRegexFormatChecker("regex"))
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("pkcs1-private-key", pkcs1PrivateKey))
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("pkcs1-public-key", pkcs1PublicKey))
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("pkcs8-private-key", pkcs8PrivateKey))
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("pkcs8-public-key", pkixPublicKey)) // deprecated, use pkix-public-key
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("pkix-public-key", pkixPublicKey))
-	gojsonschema.FormatCheckers.Add(newCryptoFormatChecker("x509-certificate", x509Certificate))
+// formatChecker is a gojsonschema.FormatChecker that can also describe why the input is not valid.
+type formatChecker interface {
+	gojsonschema.FormatChecker
+	check(input interface{}) error
 }
 
-// ----------------
-
-type formatErrors map[string]error
+var (
+	formatCheckersOnce sync.Once
 
-var formatErrs = formatErrors{}
+	// formatCheckers is only written once, while the format checkers are initialised.
+	formatCheckers = map[string]formatChecker{}
+)
 
-func (errs formatErrors) clear() {
-	formatErrs = formatErrors{}
+func initFormatCheckers() {
+	formatCheckersOnce.Do(addFormatCheckers)
 }
 
-func (errs formatErrors) add(name, value interface{}, err error) {
-	errs[errs.key(name, value)] = err
+func addFormatCheckers() {
+	addFormatChecker(newXMLFormatChecker("xml"))
+	addFormatChecker(newXMLTemplateFormatChecker("xml-template"))
+	addFormatChecker(newHTMLFormatChecker("html-template"))
+	addFormatChecker(newRegexFormatChecker("regex"))
+	addFormatChecker(newCryptoFormatChecker("pkcs1-private-key", pkcs1PrivateKey))
+	addFormatChecker(newCryptoFormatChecker("pkcs1-public-key", pkcs1PublicKey))
+	addFormatChecker(newCryptoFormatChecker("pkcs8-private-key", pkcs8PrivateKey))
+	addFormatChecker(newCryptoFormatChecker("pkcs8-public-key", pkixPublicKey)) // deprecated, use pkix-public-key
+	addFormatChecker(newCryptoFormatChecker("pkix-public-key", pkixPublicKey))
+	addFormatChecker(newCryptoFormatChecker("x509-certificate", x509Certificate))
 }
 
-func (errs formatErrors) get(name, value interface{}) error {
-	return errs[errs.key(name, value)]
+func addFormatChecker(name string, checker formatChecker) {
+	formatCheckers[name] = checker
+	// annoyingly the format checker list is a global variable, so the checkers are added to it only once
+	gojsonschema.FormatCheckers.Add(name, checker)
 }
 
-func (errs formatErrors) key(name, value interface{}) string {
-	return fmt.Sprintf("%v#%v", name, value)
+// formatError returns the reason the value does not match the named format.
+// The reason is recalculated rather than remembered, so that concurrent validations cannot see each other's errors.
+func formatError(name, value interface{}) error {
+	initFormatCheckers()
+
+	checker, ok := formatCheckers[fmt.Sprintf("%v", name)]
+	if !ok {
+		return nil
+	}
+
+	return checker.check(value)
 }
 
 // ----------------
@@ -60,28 +74,25 @@ func (errs formatErrors) key(name, value interface{}) string {
 type xmlFormatChecker struct{ name string }
 
 //nolint:unparam // left for extensibility
-func newXMLFormatChecker(name string) (string, gojsonschema.FormatChecker) {
+func newXMLFormatChecker(name string) (string, formatChecker) {
 	return name, xmlFormatChecker{name: name}
 }
 
 func (f xmlFormatChecker) IsFormat(input interface{}) bool {
-	var ferr error
+	return f.check(input) == nil
+}
 
-	if s, ok := input.(string); ok {
-		if err := xml.Unmarshal([]byte(s), new(interface{})); err != nil {
-			ferr = fmt.Errorf("failed to parse xml: %w", err)
-		}
-	} else {
-		ferr = errRequiredString
+func (f xmlFormatChecker) check(input interface{}) error {
+	s, ok := input.(string)
+	if !ok {
+		return errRequiredString
 	}
 
-	if ferr != nil {
-		formatErrs.add(f.name, input, ferr)
-
-		return false
+	if err := xml.Unmarshal([]byte(s), new(interface{})); err != nil {
+		return fmt.Errorf("failed to parse xml: %w", err)
 	}
 
-	return true
+	return nil
 }
 
 // ----------------
@@ -91,32 +102,29 @@ type xmlTemplateFormatChecker struct {
 	name string
 }
 
-func newXMLTemplateFormatChecker(name string) (string, gojsonschema.FormatChecker) {
+func newXMLTemplateFormatChecker(name string) (string, formatChecker) {
 	return name, xmlTemplateFormatChecker{name: name, tags: regexp.MustCompile(`{{[^{}]*}}`)}
 }
 
 func (f xmlTemplateFormatChecker) IsFormat(input interface{}) bool {
-	var ferr error
-
-	if s, ok := input.(string); ok {
-		s = f.tags.ReplaceAllString(s, "")
-		if s != "" {
-			var v interface{}
-			if err := xml.Unmarshal([]byte(s), &v); err != nil {
-				ferr = fmt.Errorf("failed to parse xml: %w", err)
-			}
-		}
-	} else {
-		ferr = errRequiredString
-	}
+	return f.check(input) == nil
+}
 
-	if ferr != nil {
-		formatErrs.add(f.name, input, ferr)
+func (f xmlTemplateFormatChecker) check(input interface{}) error {
+	s, ok := input.(string)
+	if !ok {
+		return errRequiredString
+	}
 
-		return false
+	s = f.tags.ReplaceAllString(s, "")
+	if s != "" {
+		var v interface{}
+		if err := xml.Unmarshal([]byte(s), &v); err != nil {
+			return fmt.Errorf("failed to parse xml: %w", err)
+		}
 	}
 
-	return true
+	return nil
 }
 
 // ----------------
@@ -126,30 +134,27 @@ type htmlFormatChecker struct {
 	name string
 }
 
-func newHTMLFormatChecker(name string) (string, gojsonschema.FormatChecker) {
+func newHTMLFormatChecker(name string) (string, formatChecker) {
 	return name, htmlFormatChecker{name: name, tags: regexp.MustCompile(`{{[^{}]*}}`)}
 }
 
 func (f htmlFormatChecker) IsFormat(input interface{}) bool {
-	var ferr error
-
-	if s, ok := input.(string); ok {
-		s = f.tags.ReplaceAllString(s, "")
+	return f.check(input) == nil
+}
 
-		if _, err := html.Parse(strings.NewReader(s)); err != nil {
-			ferr = fmt.Errorf("failed to parse html: %w", err)
-		}
-	} else {
-		ferr = errRequiredString
+func (f htmlFormatChecker) check(input interface{}) error {
+	s, ok := input.(string)
+	if !ok {
+		return errRequiredString
 	}
 
-	if ferr != nil {
-		formatErrs.add(f.name, input, ferr)
+	s = f.tags.ReplaceAllString(s, "")
 
-		return false
+	if _, err := html.Parse(strings.NewReader(s)); err != nil {
+		return fmt.Errorf("failed to parse html: %w", err)
 	}
 
-	return true
+	return nil
 }
 
 // ----------------
@@ -169,7 +174,7 @@ const (
 	x509Certificate
 )
 
-func newCryptoFormatChecker(name string, cType cryptoType) (string, gojsonschema.FormatChecker) {
+func newCryptoFormatChecker(name string, cType cryptoType) (string, formatChecker) {
 	return name, cryptoFormatChecker{
 		name:  name,
 		cType: cType,
@@ -177,11 +182,13 @@ func newCryptoFormatChecker(name string, cType cryptoType) (string, gojsonschema
 }
 
 func (f cryptoFormatChecker) IsFormat(input interface{}) bool {
+	return f.check(input) == nil
+}
+
+func (f cryptoFormatChecker) check(input interface{}) error {
 	s, ok := input.(string)
 	if !ok {
-		formatErrs.add(f.name, input, errRequiredString)
-
-		return false
+		return errRequiredString
 	}
 
 	var err error
@@ -195,9 +202,7 @@ func (f cryptoFormatChecker) IsFormat(input interface{}) bool {
 		// Try to directly base64 decode if not valid PEM
 		data, err = base64.StdEncoding.DecodeString(s)
 		if err != nil {
-			formatErrs.add(f.name, input, fmt.Errorf("failed to decode the data: %w", err))
-
-			return false
+			return fmt.Errorf("failed to decode the data: %w", err)
 		}
 	}
 
@@ -217,12 +222,10 @@ func (f cryptoFormatChecker) IsFormat(input interface{}) bool {
 	}
 
 	if err != nil {
-		formatErrs.add(f.name, input, fmt.Errorf("failed to parse key: %w", err))
-
-		return false
+		return fmt.Errorf("failed to parse key: %w", err)
 	}
 
-	return true
+	return nil
 }
 
 // ----------------
@@ -230,26 +233,23 @@ func (f cryptoFormatChecker) IsFormat(input interface{}) bool {
 type regexFormatChecker struct{ name string }
 
 //nolint:unparam // left for extensibility
-func newRegexFormatChecker(name string) (string, gojsonschema.FormatChecker) {
+func newRegexFormatChecker(name string) (string, formatChecker) {
 	return name, regexFormatChecker{name: name}
 }
 
 func (f regexFormatChecker) IsFormat(input interface{}) bool {
-	var ferr error
+	return f.check(input) == nil
+}
 
-	if s, ok := input.(string); ok {
-		if _, err := regexp.Compile(s); err != nil {
-			ferr = fmt.Errorf("failed to parse regular expression: %w", err)
-		}
-	} else {
-		ferr = errRequiredString
+func (f regexFormatChecker) check(input interface{}) error {
+	s, ok := input.(string)
+	if !ok {
+		return errRequiredString
 	}
 
-	if ferr != nil {
-		formatErrs.add(f.name, input, ferr)
-
-		return false
+	if _, err := regexp.Compile(s); err != nil {
+		return fmt.Errorf("failed to parse regular expression: %w", err)
 	}
 
-	return true
+	return nil
 }
@@ -13,34 +13,21 @@ const (
 	xmlName    = "xml"
 )
 
-func TestFormatErrors_Get(t *testing.T) {
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
-	formatErrs["name#value"] = errTest
-
-	err := formatErrs.get("name", "value")
-	assert.Equal(t, errTest, err)
-}
-
-func TestFormatErrors_Add(t *testing.T) {
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
+func TestFormatError(t *testing.T) {
+	err := formatError("regex", "^(.*$")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to parse regular expression")
 
-	formatErrs.add("name", "value", errTest)
-	assert.Equal(t, errTest, formatErrs["name#value"])
+	err = formatError("regex", "^.*$")
+	assert.Nil(t, err)
 }
 
-func TestFormatErrors_Clear(t *testing.T) {
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
+func TestFormatError_UnknownFormat(t *testing.T) {
+	err := formatError("unknown", "value")
+	assert.Nil(t, err)
 
-	formatErrs["stuff"] = nil
-	formatErrs.clear()
-	assert.Empty(t, formatErrs)
+	err = formatError(nil, "value")
+	assert.Nil(t, err)
 }
 
 // --------
@@ -49,17 +36,13 @@ func TestXmlFormatCheckerIsFormat_NotString(t *testing.T) {
 	givenName := xmlName
 	givenValue := 1
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the value is not a string")
 }
@@ -68,17 +51,13 @@ func TestXmlFormatCheckerIsFormat_Valid(t *testing.T) {
 	givenName := xmlName
 	givenValue := "<test>Value</test>"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.True(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.Nil(t, err)
 }
 
@@ -86,17 +65,13 @@ func TestXmlFormatCheckerIsFormat_NotValid(t *testing.T) {
 	givenName := xmlName
 	givenValue := "<test1>"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to parse xml")
 }
@@ -107,17 +82,13 @@ func TestXmlTemplateFormatCheckerIsFormat_NotString(t *testing.T) {
 	givenName := xmlName
 	givenValue := 1
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLTemplateFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the value is not a string")
 }
@@ -126,17 +97,13 @@ func TestXmlTemplateFormatCheckerIsFormat_Valid(t *testing.T) {
 	givenName := xmlName
 	givenValue := "<test>{{.Value}}</test>"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLTemplateFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.True(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.Nil(t, err)
 }
 
@@ -144,17 +111,13 @@ func TestXmlTemplateFormatCheckerIsFormat_NotValid(t *testing.T) {
 	givenName := xmlName
 	givenValue := "<test>"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newXMLTemplateFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to parse xml")
 }
@@ -165,17 +128,13 @@ func TestHtmlFormatCheckerIsFormat_NotString(t *testing.T) {
 	givenName := htmlName
 	givenValue := 1
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newHTMLFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the value is not a string")
 }
@@ -184,17 +143,13 @@ func TestHtmlFormatCheckerIsFormat_Valid(t *testing.T) {
 	givenName := htmlName
 	givenValue := "<html>{{.Value}}</html>"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newHTMLFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.True(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.Nil(t, err)
 }
 
@@ -208,7 +163,7 @@ func TestHtmlFormatCheckerIsFormat_NotValid(t *testing.T) {
 	assert.Equal(t, givenName, name)
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "Failed to parse html")
 }
@@ -221,17 +176,13 @@ func testCryptoFormatCheckerIsFormatNotString(t *testing.T, cryptoType cryptoTyp
 	givenName := cryptoName
 	givenValue := 1
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newCryptoFormatChecker(givenName, cryptoType)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the value is not a string")
 }
@@ -250,17 +201,13 @@ func testCryptoFormatCheckerIsFormatNotValid(t *testing.T, cryptoType cryptoType
 	givenName := cryptoName
 	givenValue := "dGhpcyBpcyBub3QgYSB2YWxpZCBjZXJ0aWZpY2F0ZQo="
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newCryptoFormatChecker(givenName, cryptoType)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to parse")
 }
@@ -278,17 +225,13 @@ func testCryptoFormatCheckerIsFormatValid(t *testing.T, cryptoType cryptoType, g
 
 	givenName := cryptoName
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newCryptoFormatChecker(givenName, cryptoType)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.True(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.Nil(t, err)
 }
 
@@ -462,15 +405,13 @@ func TestCryptoFormatCheckerIsFormat_NotBase64(t *testing.T) {
 	givenValue := "not base-64"
 	cryptoType := cryptoType(9999)
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newCryptoFormatChecker(givenName, cryptoType)
+	assert.Equal(t, givenName, name)
+
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to decode the data")
 }
@@ -480,15 +421,13 @@ func TestCryptoFormatCheckerIsFormat_UnsupportedType(t *testing.T) {
 	givenValue := ""
 	cryptoType := cryptoType(9999)
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newCryptoFormatChecker(givenName, cryptoType)
+	assert.Equal(t, givenName, name)
+
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "unsupported type")
 }
@@ -499,17 +438,13 @@ func TestRegexFormatCheckerIsFormat_NotString(t *testing.T) {
 	givenName := regexName
 	givenValue := 1
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newRegexFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the value is not a string")
 }
@@ -518,17 +453,13 @@ func TestRegexFormatCheckerIsFormat_Valid(t *testing.T) {
 	givenName := regexName
 	givenValue := "^.*$"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newRegexFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.True(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.Nil(t, err)
 }
 
@@ -536,17 +467,13 @@ func TestRegexFormatCheckerIsFormat_NotValid(t *testing.T) {
 	givenName := regexName
 	givenValue := "^(.*$"
 
-	formatErrs.clear()
-
-	defer func() { formatErrs.clear() }()
-
 	name, checker := newRegexFormatChecker(givenName)
 	assert.Equal(t, givenName, name)
 
 	result := checker.IsFormat(givenValue)
 	assert.False(t, result)
 
-	err := formatErrs.get(name, givenValue)
+	err := checker.check(givenValue)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to parse regular expression")
 }
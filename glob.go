@@ -0,0 +1,200 @@
+package conflate
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"log"
+	pkgurl "net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// globChars are the characters that make a url path a pattern. The ? of path.Match is not among them,
+// as it starts the query of a url.
+const globChars = "*["
+
+var (
+	errFailedToList = errors.New("failed to list urls matching the pattern")
+	errNoMatches    = errors.New("no urls match the pattern")
+)
+
+// Lister is an optional interface for a Loader, to list the urls that match a pattern,
+// so that includes such as conf.d/*.yaml can be expanded. The pattern is given as the url path,
+// with the syntax of path.Match. Implementations should abandon the listing and return an error once ctx is done.
+// Patterns are only expanded for the url schemes whose loader is a Lister, and are otherwise loaded literally.
+type Lister interface {
+	List(ctx gocontext.Context, pattern *pkgurl.URL) ([]*pkgurl.URL, error)
+}
+
+// fileLoader loads and lists local files.
+type fileLoader struct{}
+
+func (fileLoader) Load(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	return loadFile(ctx, url)
+}
+
+func (fileLoader) List(ctx gocontext.Context, pattern *pkgurl.URL) ([]*pkgurl.URL, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(getPath(pattern.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*pkgurl.URL, 0, len(matches))
+
+	for _, match := range matches {
+		url := *pattern
+		url.Path = setPath(match)
+		urls = append(urls, &url)
+	}
+
+	return urls, nil
+}
+
+// bucketLoader loads and lists files in Google Cloud Storage buckets.
+type bucketLoader struct{}
+
+func (bucketLoader) Load(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	return loadConfigFromBucket(ctx, url)
+}
+
+func (bucketLoader) List(ctx gocontext.Context, pattern *pkgurl.URL) ([]*pkgurl.URL, error) {
+	bucket := pattern.Host
+	glob := strings.TrimLeft(pattern.Path, "/")
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gcp storage client: %w", err)
+	}
+
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Printf("error when closing the gcp storage client: %v", err.Error())
+		}
+	}()
+
+	// only the objects before the first wildcard need to be listed
+	prefix := glob
+	if i := strings.IndexAny(glob, globChars+`\`); i >= 0 {
+		prefix = glob[:i]
+	}
+
+	var urls []*pkgurl.URL
+
+	objects := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to list files in bucket %q: %w", bucket, err)
+		}
+
+		if ok, _ := path.Match(glob, attrs.Name); ok {
+			url := *pattern
+			url.Path = "/" + attrs.Name
+			urls = append(urls, &url)
+		}
+	}
+
+	return urls, nil
+}
+
+// isGlob reports whether the url path is a pattern rather than the path of a single file.
+func isGlob(url *pkgurl.URL) bool {
+	return strings.ContainsAny(url.Path, globChars)
+}
+
+// expandGlobs replaces any include url that is a pattern with the urls matching it, in lexical order.
+// A pattern is kept as it is if its loader cannot list urls, or if a file is named by the pattern itself,
+// such as file[1].json. Matches that are already being loaded, such as the file that declares the pattern, are skipped.
+func (l *loader) expandGlobs(ctx gocontext.Context, parentUrls []*pkgurl.URL, incs []includeURL) ([]includeURL, error) {
+	var expanded []includeURL
+
+	for _, inc := range incs {
+		lister := l.lister(inc.url)
+		if !isGlob(inc.url) || lister == nil {
+			expanded = append(expanded, inc)
+
+			continue
+		}
+
+		matches, err := listGlob(ctx, lister, inc.url)
+		if err == nil && len(matches) == 0 {
+			err = errNoMatches
+		}
+
+		if err != nil {
+			if inc.isSkippable(ctx) {
+				continue
+			}
+
+			return nil, fmt.Errorf("%w : %v : %w", errFailedToList, inc.url.String(), err)
+		}
+
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].String() < matches[j].String()
+		})
+
+		for _, match := range matches {
+			if !containsURL(match, parentUrls) {
+				expanded = append(expanded, includeURL{url: match, include: inc.include})
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// lister returns the loader of the url as a Lister, or nil if it cannot list urls.
+func (l *loader) lister(url *pkgurl.URL) Lister {
+	ldr, err := lookupLoader(url.Scheme, l.loaders, Loaders)
+	if err != nil {
+		return nil
+	}
+
+	lister, _ := ldr.(Lister)
+
+	return lister
+}
+
+// listGlob lists the urls matching the pattern, unless a url is named by the pattern itself,
+// which is found by listing the pattern with its special characters escaped.
+func listGlob(ctx gocontext.Context, lister Lister, pattern *pkgurl.URL) ([]*pkgurl.URL, error) {
+	literal := *pattern
+	literal.Path = escapeGlob(pattern.Path)
+
+	matches, err := lister.List(ctx, &literal)
+	if err != nil || len(matches) > 0 {
+		return matches, err
+	}
+
+	return lister.List(ctx, pattern)
+}
+
+func escapeGlob(pattern string) string {
+	var sb strings.Builder
+
+	for _, r := range pattern {
+		if strings.ContainsRune(`*?[\`, r) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,193 @@
+package conflate
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMemoryLister struct {
+	Loader
+	files map[string]string
+}
+
+func (l testMemoryLister) List(_ gocontext.Context, pattern *url.URL) ([]*url.URL, error) {
+	var urls []*url.URL
+
+	for name := range l.files {
+		u, err := url.Parse("mem://" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok, _ := path.Match(pattern.Path, u.Path); ok && u.Host == pattern.Host {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls, nil
+}
+
+func newTestMemoryLister(files map[string]string) testMemoryLister {
+	return testMemoryLister{Loader: testMemoryLoader(files), files: files}
+}
+
+func TestIsGlob(t *testing.T) {
+	assert.True(t, isGlob(&url.URL{Path: "/conf.d/*.yaml"}))
+	assert.True(t, isGlob(&url.URL{Path: "/conf.d/[ab].yaml"}))
+	assert.False(t, isGlob(&url.URL{Path: "/conf.d/a.yaml"}))
+
+	// a ? starts the query, so it is never part of a pattern
+	u, err := url.Parse("mem://host/conf.d/?.yaml")
+	assert.Nil(t, err)
+	assert.False(t, isGlob(u))
+	assert.False(t, isGlob(&url.URL{Path: "/conf.d/?.yaml"}))
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, `/a/file\[1]\*\?\\.json`, escapeGlob(`/a/file[1]*?\.json`))
+}
+
+func TestFileLoader_List(t *testing.T) {
+	root, err := workingDir()
+	assert.Nil(t, err)
+
+	u, err := toURL(root, "testdata/conf.d/*.json")
+	assert.Nil(t, err)
+
+	urls, err := fileLoader{}.List(gocontext.Background(), u)
+	assert.Nil(t, err)
+	assert.Len(t, urls, 2)
+
+	for _, u := range urls {
+		assert.Equal(t, "file", u.Scheme)
+		assert.Contains(t, u.Path, "testdata/conf.d/")
+	}
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	_, err = fileLoader{}.List(ctx, u)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+}
+
+func TestLoadURLsRecursive_Glob(t *testing.T) {
+	root, err := workingDir()
+	assert.Nil(t, err)
+
+	u, err := toURL(root, "testdata/glob_parent.json")
+	assert.Nil(t, err)
+
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.Nil(t, err)
+	assert.Len(t, data, 3)
+	assert.Contains(t, data[0].url.String(), "conf.d/10-a.json")
+	assert.Contains(t, data[1].url.String(), "conf.d/20-b.json")
+	assert.Contains(t, data[2].url.String(), "glob_parent.json")
+}
+
+func TestConflate_GlobIncludes(t *testing.T) {
+	files := map[string]string{
+		"host/conf.d/main.json":    `{"includes": ["*.json", "extra/*.yaml"], "main": true}`,
+		"host/conf.d/b.json":       `{"all": "b"}`,
+		"host/conf.d/a.json":       `{"all": "a", "a": 1}`,
+		"host/conf.d/c.yaml":       `all: c`,
+		"host/conf.d/extra/x.yaml": `all: x`,
+	}
+
+	c := New(WithLoader("mem", newTestMemoryLister(files)))
+
+	err := c.AddFiles("mem://host/conf.d/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"all": "x", "a": 1.0, "main": true}, out)
+}
+
+func TestConflate_GlobIncludesNoMatches(t *testing.T) {
+	files := map[string]string{"host/main.json": `{"includes": ["conf.d/*.json"], "main": true}`}
+
+	c := New(WithLoader("mem", newTestMemoryLister(files)))
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.ErrorIs(t, err, errFailedToList)
+	assert.ErrorIs(t, err, errNoMatches)
+	assert.Contains(t, err.Error(), "mem://host/conf.d/*.json")
+}
+
+func TestConflate_GlobIncludesNoMatchesOptional(t *testing.T) {
+	files := map[string]string{"host/main.json": `{"includes": [{"path": "conf.d/*.json", "optional": true}], "main": true}`}
+
+	c := New(WithLoader("mem", newTestMemoryLister(files)))
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+}
+
+func TestConflate_GlobIncludesLiteral(t *testing.T) {
+	files := map[string]string{
+		"host/main.json":    `{"includes": ["file[1].json"]}`,
+		"host/file[1].json": `{"literal": true}`,
+		"host/file1.json":   `{"match": true}`,
+	}
+
+	c := New(WithLoader("mem", newTestMemoryLister(files)))
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"literal": true}, out)
+}
+
+func TestConflate_GlobIncludesNoLister(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json":     `{"includes": ["conf.d/*.json"]}`,
+		"host/conf.d/*.json": `{"literal": true}`,
+	})
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"literal": true}, out)
+}
+
+func TestConflate_GlobIncludesHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/main.json":
+			_, _ = w.Write([]byte(`{"includes": ["conf*.json"]}`))
+		case "/conf*.json":
+			_, _ = w.Write([]byte(`{"literal": true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := New()
+
+	err := c.AddFiles(server.URL + "/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"literal": true}, out)
+}
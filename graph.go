@@ -0,0 +1,242 @@
+package conflate
+
+import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	pkgurl "net/url"
+	"strconv"
+)
+
+// IncludeNode is a file in an include graph, along with the files it includes.
+type IncludeNode struct {
+	// URL is the resolved url of the file, which is blank for data that was not loaded from a url.
+	URL string `json:"url"`
+	// Path is the include path that resolved to the url, as declared by the including file.
+	Path     string `json:"path,omitempty"`
+	At       string `json:"at,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	// Error describes why the file could not be loaded, or its includes resolved.
+	Error    string         `json:"error,omitempty"`
+	Includes []*IncludeNode `json:"includes,omitempty"`
+}
+
+// IncludeGraph is the tree of files included by each of the files or data given to a Conflate instance.
+type IncludeGraph []*IncludeNode
+
+// GraphFiles resolves the includes of the given files without merging any data, see GraphURLs.
+func (c *Conflate) GraphFiles(paths ...string) (IncludeGraph, error) {
+	return c.GraphFilesContext(gocontext.Background(), paths...)
+}
+
+// GraphFilesContext is like GraphFiles, but aborts loading when ctx is done.
+func (c *Conflate) GraphFilesContext(ctx gocontext.Context, paths ...string) (IncludeGraph, error) {
+	urls, err := toURLs(nil, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GraphURLsContext(ctx, urls...)
+}
+
+// GraphURLs resolves the includes of the given urls without merging any data.
+// Any file which cannot be loaded, or whose includes cannot be resolved, is reported by its node in the graph.
+// Includes whose conditions do not hold are left out.
+func (c *Conflate) GraphURLs(urls ...*pkgurl.URL) (IncludeGraph, error) {
+	return c.GraphURLsContext(gocontext.Background(), urls...)
+}
+
+// GraphURLsContext is like GraphURLs, but aborts loading when ctx is done.
+func (c *Conflate) GraphURLsContext(ctx gocontext.Context, urls ...*pkgurl.URL) (IncludeGraph, error) {
+	l := c.getLoader()
+
+	incs := make([]includeURL, len(urls))
+	for i, url := range urls {
+		incs[i] = includeURL{url: url}
+	}
+
+	return l.graphIncludes(ctx, nil, incs), ctx.Err()
+}
+
+// GraphData resolves the includes of the given data without merging any data, see GraphURLs.
+func (c *Conflate) GraphData(data ...[]byte) (IncludeGraph, error) {
+	return c.GraphDataContext(gocontext.Background(), data...)
+}
+
+// GraphDataContext is like GraphData, but aborts loading of any includes when ctx is done.
+func (c *Conflate) GraphDataContext(ctx gocontext.Context, data ...[]byte) (IncludeGraph, error) {
+	l := c.getLoader()
+
+	graph := make(IncludeGraph, 0, len(data))
+
+	for _, datum := range data {
+		node := &IncludeNode{}
+		graph = append(graph, node)
+
+		fdata, err := l.newFiledatas(datum, &emptyURL, "")
+		if err != nil {
+			node.Error = err.Error()
+
+			continue
+		}
+
+		for j := range fdata {
+			l.graphDatum(ctx, nil, nil, &fdata[j], node)
+		}
+	}
+
+	return graph, ctx.Err()
+}
+
+func (l *loader) graphIncludes(ctx gocontext.Context, parentUrls []*pkgurl.URL, incs []includeURL) []*IncludeNode {
+	urls := make([]*pkgurl.URL, len(incs))
+	for i, inc := range incs {
+		urls[i] = inc.url
+	}
+
+	data, errs := l.fetchURLs(ctx, nil, urls...)
+
+	var nodes []*IncludeNode
+
+	for i, inc := range incs {
+		node := &IncludeNode{URL: inc.url.String(), Path: inc.path, At: inc.at, Optional: inc.optional}
+		nodes = append(nodes, node)
+
+		if errs[i] != nil {
+			node.Error = errs[i].Error()
+
+			continue
+		}
+
+		fdata, err := l.newFiledatas(data[i], inc.url, l.patchKind(inc))
+		if err != nil {
+			node.Error = err.Error()
+
+			continue
+		}
+
+		for j := range fdata {
+			l.graphDatum(ctx, parentUrls, inc.url, &fdata[j], node)
+		}
+	}
+
+	return nodes
+}
+
+// graphDatum adds the includes of the data to its node, or the reason they cannot be resolved.
+func (l *loader) graphDatum(ctx gocontext.Context, parentUrls []*pkgurl.URL, url *pkgurl.URL, data *filedata, node *IncludeNode) {
+	if containsURL(url, parentUrls) {
+		node.Error = fmt.Errorf("%w (%v)", errRecursiveURL, url).Error()
+
+		return
+	}
+
+	childIncs, err := resolveIncludes(url, data.includes...)
+	if err != nil {
+		node.Error = err.Error()
+
+		return
+	}
+
+	var newParentUrls []*pkgurl.URL
+
+	newParentUrls = append(newParentUrls, parentUrls...)
+
+	if url != nil {
+		newParentUrls = append(newParentUrls, url)
+	}
+
+	childIncs, err = l.expandGlobs(ctx, newParentUrls, childIncs)
+	if err != nil {
+		node.Error = err.Error()
+
+		return
+	}
+
+	// the includes of each document of a YAML stream are added in turn
+	node.Includes = append(node.Includes, l.graphIncludes(ctx, newParentUrls, childIncs)...)
+
+	for _, item := range data.items {
+		l.graphDatum(ctx, parentUrls, url, item.data, node)
+	}
+}
+
+// List returns the urls of the files in the order their data is merged, which is each file after those it includes.
+// A file that could not be loaded is followed by the error in brackets.
+func (g IncludeGraph) List() []string {
+	var list []string
+
+	var walk func(nodes []*IncludeNode)
+
+	walk = func(nodes []*IncludeNode) {
+		for _, node := range nodes {
+			walk(node.Includes)
+
+			line := node.name()
+			if node.Error != "" {
+				line += " (" + node.Error + ")"
+			}
+
+			list = append(list, line)
+		}
+	}
+
+	walk(g)
+
+	return list
+}
+
+// DOT returns the graph in the Graphviz DOT language. Each edge is labelled with the position of the include
+// in the includes of the file, and any path the data is mounted at. Optional includes are dashed, and errors are red.
+func (g IncludeGraph) DOT() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph includes {\n")
+
+	var id int
+
+	var walk func(parent string, nodes []*IncludeNode)
+
+	walk = func(parent string, nodes []*IncludeNode) {
+		for i, node := range nodes {
+			name := "n" + strconv.Itoa(id)
+			id++
+
+			label := node.name()
+			attrs := ""
+
+			if node.Error != "" {
+				label += "\n" + node.Error
+				attrs = ", color=red"
+			}
+
+			fmt.Fprintf(&buf, "  %v [label=%v%v];\n", name, strconv.Quote(label), attrs)
+
+			if parent != "" {
+				edge := strconv.Itoa(i + 1)
+				if node.At != "" {
+					edge += " at " + node.At
+				}
+
+				style := ""
+				if node.Optional {
+					style = ", style=dashed"
+				}
+
+				fmt.Fprintf(&buf, "  %v -> %v [label=%v%v];\n", parent, name, strconv.Quote(edge), style)
+			}
+
+			walk(name, node.Includes)
+		}
+	}
+
+	walk("", g)
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+func (n *IncludeNode) name() string {
+	return sourceName(n.URL)
+}
@@ -0,0 +1,113 @@
+package conflate
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGraphConflate() *Conflate {
+	return testMemConflate(map[string]string{
+		"host/main.json":   `{"includes": ["base.json", {"path": "local.json", "optional": true}, {"path": "db.json", "at": "/db"}]}`,
+		"host/base.json":   `{"includes": ["common.json"]}`,
+		"host/common.json": `{"x": 1}`,
+		"host/db.json":     `{"includes": ["bad.json", "main.json"]}`,
+		"host/bad.json":    `{"bad"`,
+	})
+}
+
+func TestConflate_GraphFiles(t *testing.T) {
+	graph, err := testGraphConflate().GraphFiles("mem://host/main.json")
+	assert.Nil(t, err)
+	assert.Len(t, graph, 1)
+
+	main := graph[0]
+	assert.Equal(t, "mem://host/main.json", main.URL)
+	assert.Empty(t, main.Error)
+	assert.Len(t, main.Includes, 3)
+
+	base, local, db := main.Includes[0], main.Includes[1], main.Includes[2]
+	assert.Equal(t, &IncludeNode{
+		URL:      "mem://host/base.json",
+		Path:     "base.json",
+		Includes: []*IncludeNode{{URL: "mem://host/common.json", Path: "common.json"}},
+	}, base)
+	assert.Equal(t, "mem://host/local.json", local.URL)
+	assert.True(t, local.Optional)
+	assert.Contains(t, local.Error, "failed to load url")
+	assert.Equal(t, "/db", db.At)
+	assert.Len(t, db.Includes, 2)
+	assert.Contains(t, db.Includes[0].Error, "could not unmarshal data")
+	assert.Contains(t, db.Includes[1].Error, "the url recursively includes itself")
+	assert.Empty(t, db.Includes[1].Includes)
+
+	assert.Equal(t, []string{
+		"mem://host/common.json",
+		"mem://host/base.json",
+		"mem://host/local.json (failed to load url)",
+		"mem://host/bad.json (could not unmarshal data: the data could not be unmarshalled as json: unexpected end of JSON input)",
+		"mem://host/main.json (the url recursively includes itself (mem://host/main.json))",
+		"mem://host/db.json",
+		"mem://host/main.json",
+	}, graph.List())
+}
+
+func TestConflate_GraphFilesError(t *testing.T) {
+	_, err := New().GraphFiles("")
+	assert.ErrorIs(t, err, errBlankFilePath)
+}
+
+func TestConflate_GraphFilesContext(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	graph, err := testGraphConflate().GraphFilesContext(ctx, "mem://host/main.json")
+	assert.ErrorIs(t, err, gocontext.Canceled)
+	assert.Len(t, graph, 1)
+	assert.Contains(t, graph[0].Error, "context canceled")
+
+	_, err = New().GraphFilesContext(gocontext.Background(), "")
+	assert.ErrorIs(t, err, errBlankFilePath)
+}
+
+func TestConflate_GraphData(t *testing.T) {
+	c := testGraphConflate()
+
+	graph, err := c.GraphData([]byte(`{"includes": ["mem://host/base.json"]}`), []byte(`{"bad"`),
+		[]byte(`{"includes": [{"path": "x.json", "if": "a == b == c"}]}`))
+	assert.Nil(t, err)
+	assert.Len(t, graph, 3)
+	assert.Equal(t, []string{
+		"mem://host/common.json",
+		"mem://host/base.json",
+		"<data>",
+	}, graph[:1].List())
+	assert.Contains(t, graph[1].Error, "could not unmarshal data")
+	assert.Contains(t, graph[2].Error, "the include condition is not valid")
+
+	out, err := json.Marshal(graph[:1])
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"url": "", "includes": [{"url": "mem://host/base.json", "path": "mem://host/base.json",
+		"includes": [{"url": "mem://host/common.json", "path": "common.json"}]}]}]`, string(out))
+}
+
+func TestIncludeGraph_DOT(t *testing.T) {
+	graph := IncludeGraph{{
+		URL: "mem://host/main.json",
+		Includes: []*IncludeNode{
+			{URL: "mem://host/base.json", Path: "base.json"},
+			{URL: "mem://host/db.json", Path: "db.json", At: "/db", Optional: true, Error: `failed "db"`},
+		},
+	}}
+
+	assert.Equal(t, `digraph includes {
+  n0 [label="mem://host/main.json"];
+  n1 [label="mem://host/base.json"];
+  n0 -> n1 [label="1"];
+  n2 [label="mem://host/db.json\nfailed \"db\"", color=red];
+  n0 -> n2 [label="2 at /db", style=dashed];
+}
+`, string(graph.DOT()))
+}
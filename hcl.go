@@ -0,0 +1,288 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+var (
+	errHCL          = errors.New("the data could not be marshalled to hcl")
+	errHCLConflict  = errors.New("the hcl block conflicts with another value of the same name")
+	errHCLNotObject = errors.New("the data must be an object")
+)
+
+// HCLUnmarshal unmarshals the data as HCL2 native syntax. Attributes become object properties, and blocks become
+// objects nested under their type and labels, so that server "web" { port = 80 } is {"server": {"web": {"port": 80}}}.
+// Blocks repeated with the same type and labels become an array of objects. Expressions may not refer to variables.
+func HCLUnmarshal(data []byte, out interface{}) error {
+	obj, err := hclDecode(data, "", nil)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as hcl: %w", err)
+	}
+
+	return jsonMarshalUnmarshal(obj, out)
+}
+
+// hclDecode decodes the data, recording the positions of the values in pos if it is not nil.
+func hclDecode(data []byte, source string, pos positions) (map[string]interface{}, error) {
+	file, diags := hclsyntax.ParseConfig(data, source, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, errHCLNotObject
+	}
+
+	d := hclDecoder{source: source, pos: pos}
+	d.record(rootContext(), body.Range())
+
+	return d.body(rootContext(), body)
+}
+
+// locateHCLPositions finds the positions of the values within HCL data.
+func locateHCLPositions(data []byte, source string) positions {
+	pos := positions{}
+
+	_, err := hclDecode(data, source, pos)
+	if err != nil {
+		return nil
+	}
+
+	return pos
+}
+
+type hclDecoder struct {
+	source string
+	pos    positions
+}
+
+func (d hclDecoder) record(ctx context, rng hcl.Range) {
+	if d.pos != nil {
+		d.pos[ctx.pointer()] = position{source: d.source, line: rng.Start.Line, column: rng.Start.Column}
+	}
+}
+
+func (d hclDecoder) body(ctx context, body *hclsyntax.Body) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+
+	for name, attr := range body.Attributes {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		v, err := ctyToGo(val)
+		if err != nil {
+			return nil, err
+		}
+
+		obj[name] = v
+		d.expr(ctx.add(name), attr.Expr)
+	}
+
+	counts := map[string]int{}
+	for _, block := range body.Blocks {
+		counts[hclBlockKey(block)]++
+	}
+
+	for _, block := range body.Blocks {
+		err := d.block(ctx, obj, block, counts[hclBlockKey(block)] > 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+func hclBlockKey(block *hclsyntax.Block) string {
+	return strings.Join(append([]string{block.Type}, block.Labels...), "\x00")
+}
+
+// block adds the block to the object under its type and labels, appending it to an array if it is repeated.
+func (d hclDecoder) block(ctx context, obj map[string]interface{}, block *hclsyntax.Block, repeated bool) error {
+	names := append([]string{block.Type}, block.Labels...)
+	parent := obj
+
+	for _, name := range names[:len(names)-1] {
+		ctx = ctx.add(name)
+
+		child, ok := parent[name].(map[string]interface{})
+		if !ok {
+			if _, exists := parent[name]; exists {
+				return fmt.Errorf("%w : %v", errHCLConflict, ctx)
+			}
+
+			child = map[string]interface{}{}
+			parent[name] = child
+		}
+
+		parent = child
+	}
+
+	name := names[len(names)-1]
+	ctx = ctx.add(name)
+
+	var items []interface{}
+
+	if repeated {
+		var ok bool
+
+		items, ok = parent[name].([]interface{})
+		if _, exists := parent[name]; exists && !ok {
+			return fmt.Errorf("%w : %v", errHCLConflict, ctx)
+		}
+
+		ctx = ctx.addInt(len(items))
+	} else if _, exists := parent[name]; exists {
+		return fmt.Errorf("%w : %v", errHCLConflict, ctx)
+	}
+
+	val, err := d.body(ctx, block.Body)
+	if err != nil {
+		return err
+	}
+
+	d.record(ctx, block.DefRange())
+
+	if repeated {
+		parent[name] = append(items, val)
+	} else {
+		parent[name] = val
+	}
+
+	return nil
+}
+
+// expr records the positions of the value of the expression, and of the items of any object or tuple it constructs.
+func (d hclDecoder) expr(ctx context, expr hclsyntax.Expression) {
+	d.record(ctx, expr.Range())
+
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		for _, item := range e.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if !diags.HasErrors() && key.Type() == cty.String && key.IsKnown() && !key.IsNull() {
+				d.expr(ctx.add(key.AsString()), item.ValueExpr)
+			}
+		}
+	case *hclsyntax.TupleConsExpr:
+		for i, item := range e.Exprs {
+			d.expr(ctx.addInt(i), item)
+		}
+	}
+}
+
+func ctyToGo(val cty.Value) (interface{}, error) {
+	b, err := ctyjson.SimpleJSONValue{Value: val}.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+
+	err = JSONUnmarshal(b, &v)
+
+	return v, err
+}
+
+func goToCty(value interface{}) cty.Value {
+	switch v := value.(type) {
+	case bool:
+		return cty.BoolVal(v)
+	case float64:
+		return cty.NumberFloatVal(v)
+	case string:
+		return cty.StringVal(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal
+		}
+
+		items := make([]cty.Value, len(v))
+		for i, item := range v {
+			items[i] = goToCty(item)
+		}
+
+		return cty.TupleVal(items)
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return cty.EmptyObjectVal
+		}
+
+		props := make(map[string]cty.Value, len(v))
+		for name, prop := range v {
+			props[name] = goToCty(prop)
+		}
+
+		return cty.ObjectVal(props)
+	default:
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+}
+
+func hclMarshal(in interface{}) ([]byte, error) {
+	var data interface{}
+
+	err := jsonMarshalUnmarshal(in, &data)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %w", errHCL, err)
+	}
+
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w : %w", errHCL, errHCLNotObject)
+	}
+
+	for name := range obj {
+		if !hclsyntax.ValidIdentifier(name) {
+			return nil, fmt.Errorf("%w : the top level key is not a valid identifier : %v", errHCL, name)
+		}
+	}
+
+	file := hclwrite.NewEmptyFile()
+	hclWriteBody(file.Body(), obj)
+
+	return file.Bytes(), nil
+}
+
+// hclWriteBody writes the properties of the object to the body, in key order.
+// An object whose keys are all valid identifiers is written as a block, and any other value as an attribute.
+func hclWriteBody(body *hclwrite.Body, obj map[string]interface{}) {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if child, ok := obj[name].(map[string]interface{}); ok && hclIsBlock(child) {
+			hclWriteBody(body.AppendNewBlock(name, nil).Body(), child)
+
+			continue
+		}
+
+		body.SetAttributeValue(name, goToCty(obj[name]))
+	}
+}
+
+func hclIsBlock(obj map[string]interface{}) bool {
+	for name := range obj {
+		if !hclsyntax.ValidIdentifier(name) {
+			return false
+		}
+	}
+
+	return true
+}
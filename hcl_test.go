@@ -0,0 +1,158 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHCL = `includes = ["base.yaml"]
+name     = "app"
+port     = 8080
+debug    = false
+tags     = ["a", "b"]
+limits   = { cpu = 1.5, "mem.max" = "1G" }
+nothing  = null
+
+db {
+  host = "localhost"
+}
+
+server "web" {
+  port = 80
+}
+
+server "api" {
+  port = 81
+}
+
+rule {
+  allow = true
+}
+
+rule {
+  allow = false
+}
+`
+
+func TestHCLUnmarshal(t *testing.T) {
+	var out interface{}
+
+	err := HCLUnmarshal([]byte(testHCL), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{
+		"includes": ["base.yaml"],
+		"name": "app",
+		"port": 8080,
+		"debug": false,
+		"tags": ["a", "b"],
+		"limits": {"cpu": 1.5, "mem.max": "1G"},
+		"nothing": null,
+		"db": {"host": "localhost"},
+		"server": {"web": {"port": 80}, "api": {"port": 81}},
+		"rule": [{"allow": true}, {"allow": false}]
+	}`)), out)
+}
+
+func TestHCLUnmarshal_Error(t *testing.T) {
+	for _, data := range []string{
+		`x = `,
+		`x = var.y`,
+		"db = 1\ndb {\n}\n",
+		"db {\n}\ndb {\n}\ndb = 1\n",
+		"a = 1\na \"b\" {\n}\n",
+	} {
+		var out interface{}
+
+		err := HCLUnmarshal([]byte(data), &out)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "the data could not be unmarshalled as hcl", data)
+	}
+}
+
+func TestLocateHCLPositions(t *testing.T) {
+	pos := locatePositions([]byte(testHCL), "x.hcl", ".hcl")
+	assert.Equal(t, position{source: "x.hcl", line: 1, column: 1}, pos[""])
+	assert.Equal(t, position{source: "x.hcl", line: 3, column: 12}, pos["/port"])
+	assert.Equal(t, position{source: "x.hcl", line: 5, column: 18}, pos["/tags/1"])
+	assert.Equal(t, position{source: "x.hcl", line: 6, column: 37}, pos["/limits/mem.max"])
+	assert.Equal(t, position{source: "x.hcl", line: 10, column: 10}, pos["/db/host"])
+	assert.Equal(t, position{source: "x.hcl", line: 17, column: 1}, pos["/server/api"])
+	assert.Equal(t, position{source: "x.hcl", line: 18, column: 10}, pos["/server/api/port"])
+	assert.Equal(t, position{source: "x.hcl", line: 26, column: 11}, pos["/rule/1/allow"])
+
+	assert.Nil(t, locateHCLPositions([]byte(`x = `), "x.hcl"))
+}
+
+func TestHCLMarshal(t *testing.T) {
+	data := testMergeGetData(t, []byte(`{
+		"name": "app",
+		"port": 8080,
+		"tmpl": "${x}",
+		"tags": ["a", {"b": 1}],
+		"db": {"host": "localhost", "opts": {"ssl": true}},
+		"limits": {"mem.max": "1G"},
+		"empty": {},
+		"nothing": null
+	}`))
+
+	out, err := hclMarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, `db {
+  host = "localhost"
+  opts {
+    ssl = true
+  }
+}
+empty {
+}
+limits = {
+  "mem.max" = "1G"
+}
+name    = "app"
+nothing = null
+port    = 8080
+tags = ["a", {
+  b = 1
+}]
+tmpl = "$${x}"
+`, string(out))
+
+	var back interface{}
+
+	err = HCLUnmarshal(out, &back)
+	assert.Nil(t, err)
+	assert.Equal(t, data, back)
+}
+
+func TestHCLMarshal_Error(t *testing.T) {
+	_, err := hclMarshal([]interface{}{1})
+	assert.ErrorIs(t, err, errHCL)
+
+	_, err = hclMarshal(map[string]interface{}{"a.b": 1})
+	assert.ErrorIs(t, err, errHCL)
+
+	_, err = hclMarshal(map[string]interface{}{"a": func() {}})
+	assert.ErrorIs(t, err, errHCL)
+}
+
+func TestConflate_HCL(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.hcl":  "includes = [\"base.yaml\"]\n\ndb {\n  port = 5432\n}\n",
+		"host/base.yaml": "db:\n  host: localhost\n  port: 1\n",
+	})
+
+	err := c.AddFiles("mem://host/main.hcl")
+	assert.Nil(t, err)
+
+	out, err := c.MarshalHCL()
+	assert.Nil(t, err)
+	assert.Equal(t, "db {\n  host = \"localhost\"\n  port = 5432\n}\n", string(out))
+
+	s, err := NewSchemaData([]byte(`{"properties": {"db": {"properties": {"port": {"type": "string"}}}}}`))
+	assert.Nil(t, err)
+
+	err = c.Validate(s)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "#/db/port at mem://host/main.hcl:4:10")
+}
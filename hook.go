@@ -0,0 +1,53 @@
+package conflate
+
+import "reflect"
+
+// MergeFunc merges a value into the value it overrides, and returns the merged value.
+// It is passed the JSON pointer of the value, the overridden value, and the value merged into it.
+// A MergeFunc must not call the methods of the Conflate instance it is registered with.
+type MergeFunc func(path string, toData, fromData interface{}) (interface{}, error)
+
+type pathMergeFunc struct {
+	path string
+	fn   MergeFunc
+}
+
+// mergeFunc returns the merge function for the value at the JSON pointer, or nil if there is none.
+// The last path added which matches the pointer wins.
+func (a mergeRules) mergeFunc(ptr string) MergeFunc {
+	for i := len(a.funcs) - 1; i >= 0; i-- {
+		if matchPath(a.funcs[i].path, ptr) {
+			return a.funcs[i].fn
+		}
+	}
+
+	return nil
+}
+
+// withMergeFunc returns a copy of the configuration with the merge function added, so that copies already taken are unaffected.
+func (a mergeRules) withMergeFunc(p string, fn MergeFunc) mergeRules {
+	funcs := make([]pathMergeFunc, len(a.funcs), len(a.funcs)+1)
+	copy(funcs, a.funcs)
+	a.funcs = append(funcs, pathMergeFunc{path: p, fn: fn})
+
+	return a
+}
+
+// mergeFunc merges the value located by from in the source data into the value located by ctx with the merge function.
+func (m merger) mergeFunc(ctx, from context, fn MergeFunc, toVal reflect.Value, toData, fromData interface{}) error {
+	merged, err := fn(ctx.pointer(), toData, fromData)
+	if err != nil {
+		return m.error(ctx, from, err.Error())
+	}
+
+	merged = m.rules.stripDeletes(merged)
+	m.overwrite(ctx, from, toData, merged)
+
+	if merged == nil {
+		toVal.Set(reflect.Zero(toVal.Type()))
+	} else {
+		toVal.Set(reflect.ValueOf(merged))
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package conflate
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestMergeFunc = errors.New("test merge func error")
+
+func testMaxMergeFunc(_ string, toData, fromData interface{}) (interface{}, error) {
+	to, ok := toData.(float64)
+	from, ok2 := fromData.(float64)
+
+	if !ok || !ok2 {
+		return nil, errTestMergeFunc
+	}
+
+	return math.Max(to, from), nil
+}
+
+func testConcatMergeFunc(_ string, toData, fromData interface{}) (interface{}, error) {
+	to, _ := toData.(string)
+	from, _ := fromData.(string)
+
+	return strings.Join([]string{to, from}, ","), nil
+}
+
+func TestMergeRules_MergeFunc(t *testing.T) {
+	var a mergeRules
+	assert.Nil(t, a.mergeFunc("/x"))
+
+	b := a.withMergeFunc("/x", testMaxMergeFunc)
+	b = b.withMergeFunc("/features/*", testConcatMergeFunc)
+	b = b.withMergeFunc("/features/off", nil)
+
+	assert.Nil(t, a.mergeFunc("/x"))
+	assert.NotNil(t, b.mergeFunc("/x"))
+	assert.NotNil(t, b.mergeFunc("/features/on"))
+	assert.Nil(t, b.mergeFunc("/features/off"))
+	assert.Nil(t, b.mergeFunc("/features/on/x"))
+}
+
+func TestMerge_MergeFunc(t *testing.T) {
+	var paths []string
+
+	rules := mergeRules{}.
+		withMergeFunc("/limit", testMaxMergeFunc).
+		withMergeFunc("/features/*", testConcatMergeFunc).
+		withMergeFunc("/db", func(path string, _, fromData interface{}) (interface{}, error) {
+			paths = append(paths, path)
+
+			return fromData, nil
+		})
+
+	data, err := testMergeWith(t, merger{rules: rules},
+		`{"limit": 10, "features": {"a": "x"}, "db": {"host": "a", "port": 1}}`,
+		`{"limit": 5, "features": {"a": "y", "b": "z"}, "db": {"host": "b"}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"limit": 10, "features": {"a": "x,y", "b": "z"}, "db": {"host": "b"}}`)), data)
+	assert.Equal(t, []string{"/db"}, paths)
+}
+
+func TestMerge_MergeFuncNil(t *testing.T) {
+	rules := mergeRules{}.withMergeFunc("/a", func(string, interface{}, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+
+	data, err := testMergeWith(t, merger{rules: rules}, `{"a": 1, "b": 2}`, `{"a": 3}`)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": nil, "b": 2.0}, data)
+}
+
+func TestMerge_MergeFuncError(t *testing.T) {
+	rules := mergeRules{}.withMergeFunc("/limit", testMaxMergeFunc)
+
+	_, err := testMergeWith(t, merger{rules: rules}, `{"limit": 10}`, `{"limit": "x"}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "test merge func error (#/limit)")
+}
+
+func TestConflate_MergeFunc(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.json": `{"limit": 10, "name": "a"}`,
+		"host/prod.json": `{"limit": 20, "name": "b"}`,
+	}, WithMergeFunc("/limit", testMaxMergeFunc), WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.json", "mem://host/prod.json")
+	assert.Nil(t, err)
+
+	val, err := c.Lookup("/limit")
+	assert.Nil(t, err)
+	assert.Equal(t, 20.0, val)
+
+	p := c.Provenance("/limit")
+	assert.NotNil(t, p)
+	assert.Equal(t, "mem://host/prod.json", p.Source)
+	assert.Equal(t, []string{"mem://host/base.json"}, p.Overridden)
+}
@@ -0,0 +1,348 @@
+package conflate
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pkgurl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// includeDirective declares includes inside any object, which are merged under that object.
+const includeDirective = "$include"
+
+var errInvalidCondition = errors.New("the include condition is not valid")
+
+// include is an entry of an includes array, which is either the path of the data to include,
+// or an object with the path and the options for including it.
+type include struct {
+	path string
+	// optional skips the include if its data cannot be loaded.
+	optional bool
+	// cond is a condition that must hold for the data to be included, see evalCondition.
+	cond string
+	// at is a JSON pointer to the object under which the data is merged, rather than at the root.
+	at string
+	// patch is set if the data patches the merged data rather than being merged into it.
+	patch patchKind
+}
+
+func (inc *include) UnmarshalJSON(b []byte) error {
+	var path string
+
+	err := json.Unmarshal(b, &path)
+	if err == nil {
+		*inc = include{path: path}
+
+		return nil
+	}
+
+	var obj struct {
+		Path     string `json:"path"`
+		Optional bool   `json:"optional"`
+		If       string `json:"if"`
+		At       string `json:"at"`
+		Patch    string `json:"patch"`
+	}
+
+	err = json.Unmarshal(b, &obj)
+	if err != nil {
+		return err
+	}
+
+	patch, err := parsePatchKind(obj.Patch)
+	if err != nil {
+		return err
+	}
+
+	*inc = include{path: obj.Path, optional: obj.Optional, cond: obj.If, at: obj.At, patch: patch}
+
+	return nil
+}
+
+// itemIncludes are the includes declared within an item of an array. Unlike the other includes, their data is merged
+// under the item before the item is merged, since the index at which the item is merged is not known until then.
+type itemIncludes struct {
+	// ptr locates the item within the data that declares it.
+	ptr string
+	// data holds the item and the includes declared within it, relative to it.
+	data *filedata
+	// fdata is the data loaded for the item, which is the data it includes followed by the item itself.
+	fdata filedatas
+}
+
+// extractNestedIncludes extracts the includes declared by the keys in the object located by ctx, along with those
+// declared in its descendants by the include directive, or by the includes key unless it is blank.
+// The includes are mounted under the object that declares them, after any includes already extracted.
+func (fd *filedata) extractNestedIncludes(ctx context, obj map[string]interface{}, keys []string, includes string) error {
+	for _, key := range keys {
+		value, ok := obj[key]
+		if !ok {
+			continue
+		}
+
+		incs, err := fd.nestedIncludes(ctx.add(key), value)
+		if err != nil {
+			return fmt.Errorf("could not extract includes (%v): %w", ctx.add(key), err)
+		}
+
+		for _, inc := range incs {
+			inc.at = ctx.pointer() + inc.at
+			fd.includes = append(fd.includes, inc)
+		}
+
+		delete(obj, key)
+	}
+
+	nestedKeys := []string{includeDirective}
+	if includes != "" {
+		nestedKeys = append(nestedKeys, includes)
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := fd.extractChildIncludes(ctx.add(name), obj[name], nestedKeys, includes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractChildIncludes extracts the includes declared within the value located by ctx, which is either an object,
+// or an array whose items each hold their own includes.
+func (fd *filedata) extractChildIncludes(ctx context, value interface{}, keys []string, includes string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return fd.extractNestedIncludes(ctx, v, keys, includes)
+	case []interface{}:
+		for i, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				err := fd.extractChildIncludes(ctx.addInt(i), item, keys, includes)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// the positions of the declaring data locate the includes of the item while they are validated
+			itemFd := &filedata{url: fd.url, obj: obj, positions: fd.positions}
+
+			err := itemFd.extractNestedIncludes(ctx.addInt(i), obj, keys, includes)
+			if err != nil {
+				return err
+			}
+
+			if len(itemFd.includes) == 0 && len(itemFd.items) == 0 {
+				continue
+			}
+
+			// the includes of the item are mounted relative to it
+			ptr := ctx.addInt(i).pointer()
+
+			for j := range itemFd.includes {
+				itemFd.includes[j].at = strings.TrimPrefix(itemFd.includes[j].at, ptr)
+			}
+
+			for j := range itemFd.items {
+				itemFd.items[j].ptr = strings.TrimPrefix(itemFd.items[j].ptr, ptr)
+			}
+
+			itemFd.positions = nil
+			fd.items = append(fd.items, itemIncludes{ptr: ptr, data: itemFd})
+		}
+	}
+
+	return nil
+}
+
+// nestedIncludes unmarshals the includes declared by the value located by ctx, which is either a single include
+// or an array of them, after validating them against the same schema as the includes array at the root.
+func (fd *filedata) nestedIncludes(ctx context, value interface{}) ([]include, error) {
+	prefix := ""
+	if _, ok := value.([]interface{}); !ok {
+		value = []interface{}{value}
+		prefix = "/0"
+	}
+
+	err := validateAt(value, includesSchema(), movedPositions{src: fd.positions, from: ctx.pointer(), to: prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	var incs []include
+
+	err = jsonMarshalUnmarshal(value, &incs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inc := range incs {
+		if inc.path == "" {
+			return nil, errBlankFilePath
+		}
+
+		_, err = splitPointer(inc.at)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return incs, nil
+}
+
+// includeURL is the url of an included file, after any pattern in the include path has been expanded.
+type includeURL struct {
+	url *pkgurl.URL
+	include
+}
+
+// resolveIncludes returns the urls of the includes whose conditions hold, resolved relative to the including url.
+func resolveIncludes(rootURL *pkgurl.URL, includes ...include) ([]includeURL, error) {
+	var urls []includeURL
+
+	for _, inc := range includes {
+		ok, err := evalCondition(inc.cond)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		_, err = splitPointer(inc.at)
+		if err != nil {
+			return nil, fmt.Errorf("could not mount include %v: %w", inc.path, err)
+		}
+
+		url, err := toURL(rootURL, inc.path)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, includeURL{url: url, include: inc})
+	}
+
+	return urls, nil
+}
+
+// evalCondition reports whether the condition of an include holds. The condition is either a comparison
+// such as "${ENV} == prod" or "${ENV} != prod", or a single boolean value as parsed by strconv.ParseBool,
+// such as "${DEBUG}", which does not hold if it is blank. Any other single value, such as "no", is an error.
+// Any environment variables are expanded, as blank if they are not set. A blank condition always holds.
+func evalCondition(cond string) (bool, error) {
+	if strings.TrimSpace(cond) == "" {
+		return true, nil
+	}
+
+	expanded := os.Expand(cond, os.Getenv)
+
+	for _, op := range []string{"==", "!="} {
+		lhs, rhs, ok := strings.Cut(expanded, op)
+		if !ok {
+			continue
+		}
+
+		if strings.Contains(lhs, "!=") || strings.Contains(rhs, "==") || strings.Contains(rhs, "!=") {
+			return false, fmt.Errorf("%w : %q", errInvalidCondition, cond)
+		}
+
+		return (conditionOperand(lhs) == conditionOperand(rhs)) == (op == "=="), nil
+	}
+
+	value := conditionOperand(expanded)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w : %q", errInvalidCondition, cond)
+	}
+
+	return b, nil
+}
+
+// conditionOperand trims the spaces and any quotes around an operand of a condition.
+func conditionOperand(s string) string {
+	s = strings.TrimSpace(s)
+
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// patchKind returns the kind of patch held by the included data, which is given by the include,
+// or by the suffix of the file name if patch suffixes are honoured.
+func (l *loader) patchKind(inc includeURL) patchKind {
+	if inc.patch == "" && l.patchSuffixes {
+		return patchKindOf(inc.url.Path)
+	}
+
+	return inc.patch
+}
+
+// isSkippable reports whether an optional include can be skipped after failing to load, which it cannot if ctx is done.
+func (inc includeURL) isSkippable(ctx gocontext.Context) bool {
+	return inc.optional && ctx.Err() == nil
+}
+
+// mount moves the data under the object located by the JSON pointer, so that it is merged there rather than at the root.
+func (fd *filedata) mount(ptr string) {
+	if ptr == "" || fd.isEmpty() {
+		return
+	}
+
+	tokens, _ := splitPointer(ptr)
+
+	switch fd.patch {
+	case mergePatch:
+		fd.patchDoc = nest(fd.patchDoc, tokens)
+	case jsonPatch:
+		ops, _ := fd.patchDoc.([]interface{})
+		for _, op := range ops {
+			props, _ := op.(map[string]interface{})
+			for _, key := range []string{"path", "from"} {
+				if p, ok := props[key].(string); ok {
+					props[key] = ptr + p
+				}
+			}
+		}
+	default:
+		fd.obj, _ = nest(fd.obj, tokens).(map[string]interface{})
+	}
+
+	for i := range fd.items {
+		fd.items[i].ptr = ptr + fd.items[i].ptr
+	}
+
+	// the positions of a json patch locate its operations, which do not move
+	if fd.patch != jsonPatch && fd.positions != nil {
+		fd.positions = movedPositions{src: fd.positions, to: ptr}
+	}
+}
+
+// nest returns the value wrapped in an object for each of the tokens, so that the tokens locate it.
+func nest(value interface{}, tokens []string) interface{} {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		value = map[string]interface{}{tokens[i]: value}
+	}
+
+	return value
+}
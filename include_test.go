@@ -0,0 +1,422 @@
+package conflate
+
+import (
+	gocontext "context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInclude_UnmarshalJSON(t *testing.T) {
+	var incs []include
+
+	err := JSONUnmarshal([]byte(`["a.json", {"path": "b.json", "optional": true}, {"path": "c.json", "if": "$ENV == prod"}]`), &incs)
+	assert.Nil(t, err)
+	assert.Equal(t, []include{
+		{path: "a.json"},
+		{path: "b.json", optional: true},
+		{path: "c.json", cond: "$ENV == prod"},
+	}, incs)
+
+	err = JSONUnmarshal([]byte(`[1]`), &incs)
+	assert.NotNil(t, err)
+}
+
+func TestEvalCondition(t *testing.T) {
+	t.Setenv("CONFLATE_TEST_ENV", "prod")
+	t.Setenv("CONFLATE_TEST_FLAG", "1")
+
+	tests := []struct {
+		cond     string
+		expected bool
+	}{
+		{"", true},
+		{"${CONFLATE_TEST_ENV} == prod", true},
+		{"$CONFLATE_TEST_ENV==prod", true},
+		{`"${CONFLATE_TEST_ENV}" == "prod"`, true},
+		{"${CONFLATE_TEST_ENV} == 'dev'", false},
+		{"${CONFLATE_TEST_ENV} != dev", true},
+		{"${CONFLATE_TEST_ENV} != prod", false},
+		{"${CONFLATE_TEST_UNSET} == ''", true},
+		{"${CONFLATE_TEST_FLAG}", true},
+		{"${CONFLATE_TEST_UNSET}", false},
+		{"true", true},
+		{" TRUE ", true},
+		{"'t'", true},
+		{"false", false},
+		{"0", false},
+	}
+
+	for _, test := range tests {
+		ok, err := evalCondition(test.cond)
+		assert.Nil(t, err, test.cond)
+		assert.Equal(t, test.expected, ok, test.cond)
+	}
+}
+
+func TestEvalCondition_Error(t *testing.T) {
+	t.Setenv("CONFLATE_TEST_ENV", "prod")
+
+	// a single value is not taken to hold just because it is not blank
+	for _, cond := range []string{
+		"a == b == c", "a != b == c", "a == b != c", "no", "off", "disabled", "yes", "${CONFLATE_TEST_ENV}",
+	} {
+		_, err := evalCondition(cond)
+		assert.ErrorIs(t, err, errInvalidCondition, cond)
+	}
+}
+
+func TestResolveIncludes(t *testing.T) {
+	root, err := url.Parse("mem://host/dir/main.json")
+	assert.Nil(t, err)
+
+	incs, err := resolveIncludes(root, include{path: "a.json"}, include{path: "b.json", cond: "false"},
+		include{path: "../c.json", optional: true})
+	assert.Nil(t, err)
+	assert.Len(t, incs, 2)
+	assert.Equal(t, "mem://host/dir/a.json", incs[0].url.String())
+	assert.Equal(t, "mem://host/c.json", incs[1].url.String())
+	assert.True(t, incs[1].optional)
+
+	_, err = resolveIncludes(root, include{path: "a.json", cond: "a == b == c"})
+	assert.ErrorIs(t, err, errInvalidCondition)
+
+	_, err = resolveIncludes(root, include{optional: true})
+	assert.ErrorIs(t, err, errBlankFilePath)
+}
+
+func TestIncludeURL_IsSkippable(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+
+	assert.False(t, includeURL{}.isSkippable(ctx))
+	assert.True(t, includeURL{include: include{optional: true}}.isSkippable(ctx))
+
+	cancel()
+	assert.False(t, includeURL{include: include{optional: true}}.isSkippable(ctx))
+}
+
+func TestFiledata_ObjectIncludes(t *testing.T) {
+	fd, err := testLoader.wrapFiledata([]byte(`{"includes": ["a", {"path": "b", "optional": true, "if": "x"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []include{{path: "a"}, {path: "b", optional: true, cond: "x"}}, fd.includes)
+
+	for _, data := range []string{
+		`{"includes": [{"optional": true}]}`,
+		`{"includes": [{"path": "b", "optional": "yes"}]}`,
+		`{"includes": [{"path": "b", "other": 1}]}`,
+	} {
+		_, err = testLoader.wrapFiledata([]byte(data))
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "not valid against the schema", data)
+	}
+}
+
+func TestConflate_OptionalIncludes(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json": `{"includes": [{"path": "local.json", "optional": true}, "base.json"], "main": true}`,
+		"host/base.json": `{"base": true}`,
+	})
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"main": true, "base": true}, out)
+}
+
+func TestConflate_OptionalIncludesInvalid(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json":  `{"includes": [{"path": "local.json", "optional": true}]}`,
+		"host/local.json": `{"bad"`,
+	})
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not unmarshal data")
+}
+
+func TestConflate_ConditionalIncludes(t *testing.T) {
+	files := map[string]string{
+		"host/main.yaml": "includes:\n  - path: prod.yaml\n    if: ${CONFLATE_TEST_ENV} == prod\n" +
+			"  - path: dev.yaml\n    if: ${CONFLATE_TEST_ENV} == dev\n",
+		"host/prod.yaml": "env: prod\n",
+		"host/dev.yaml":  "env: dev\n",
+	}
+
+	for _, env := range []string{"prod", "dev"} {
+		t.Setenv("CONFLATE_TEST_ENV", env)
+
+		c := testMemConflate(files)
+
+		err := c.AddFiles("mem://host/main.yaml")
+		assert.Nil(t, err)
+
+		val, err := c.Lookup("/env")
+		assert.Nil(t, err)
+		assert.Equal(t, env, val)
+	}
+}
+
+func TestNest(t *testing.T) {
+	assert.Equal(t, 1, nest(1, nil))
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 1}}, nest(1, []string{"a", "b"}))
+}
+
+func TestFiledata_Mount(t *testing.T) {
+	fd := filedata{
+		obj:       map[string]interface{}{"host": "a"},
+		positions: positions{"": {line: 1, column: 1}, "/host": {line: 1, column: 7}},
+	}
+	fd.mount("/services/db")
+	assert.Equal(t, map[string]interface{}{"services": map[string]interface{}{"db": map[string]interface{}{"host": "a"}}}, fd.obj)
+	assert.Equal(t, position{line: 1, column: 1}, positionOf(fd.positions, rootContext().add("services").add("db")))
+	assert.Equal(t, position{line: 1, column: 7}, positionOf(fd.positions, rootContext().add("services").add("db").add("host")))
+	assert.Equal(t, position{}, positionOf(fd.positions, rootContext().add("host")))
+
+	fd = filedata{patch: jsonPatch, patchDoc: []interface{}{
+		map[string]interface{}{"op": "move", "from": "/a", "path": "/b"},
+	}, positions: positions{"/0": {line: 1, column: 1}}}
+	fd.mount("/x")
+	assert.Equal(t, []interface{}{map[string]interface{}{"op": "move", "from": "/x/a", "path": "/x/b"}}, fd.patchDoc)
+	assert.Equal(t, positions{"/0": {line: 1, column: 1}}, fd.positions)
+
+	fd = filedata{patch: mergePatch, patchDoc: map[string]interface{}{"a": nil}}
+	fd.mount("/x")
+	assert.Equal(t, map[string]interface{}{"x": map[string]interface{}{"a": nil}}, fd.patchDoc)
+
+	fd = filedata{}
+	fd.mount("/x")
+	assert.Nil(t, fd.obj)
+}
+
+func TestConflate_MountedIncludes(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml": "includes:\n  - path: db.yaml\n    at: /services/db\n" +
+			"  - path: cache.yaml\n    at: /services/cache\n  - path: db-user.yaml\n    at: /services/db\n    patch: merge\n" +
+			"services:\n  db:\n    port: 5432\n",
+		"host/db.yaml":      "includes:\n  - path: tls.yaml\n    at: /tls\nhost: db\nport: 1\n",
+		"host/tls.yaml":     "enabled: true\n",
+		"host/cache.yaml":   "host: cache\n",
+		"host/db-user.yaml": "user: admin\n",
+	}, WithProvenance(true))
+
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"services": {
+		"db": {"host": "db", "port": 5432, "user": "admin", "tls": {"enabled": true}},
+		"cache": {"host": "cache"}
+	}}`)), out)
+
+	p := c.Provenance("/services/db/tls/enabled")
+	assert.NotNil(t, p)
+	assert.Equal(t, "mem://host/tls.yaml", p.Source)
+}
+
+func TestConflate_MountedIncludePosition(t *testing.T) {
+	s, err := NewSchemaData([]byte(`{"properties": {"services": {"properties": {"db": {"properties": {"port": {"type": "integer"}}}}}}}`))
+	assert.Nil(t, err)
+
+	c := testMemConflate(map[string]string{
+		"host/main.json": `{"includes": [{"path": "db.yaml", "at": "/services/db"}]}`,
+		"host/db.yaml":   "host: db\nport: high\n",
+	})
+
+	err = c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+
+	err = c.Validate(s)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "#/services/db/port at mem://host/db.yaml:2:7")
+}
+
+func TestConflate_MountedIncludeInvalid(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json": `{"includes": [{"path": "db.yaml", "at": "services"}]}`,
+	})
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.ErrorIs(t, err, errInvalidPointer)
+	assert.Contains(t, err.Error(), "could not mount include db.yaml")
+}
+
+func TestFiledata_NestedIncludes(t *testing.T) {
+	data := []byte(`{
+		"includes": ["base.json"],
+		"$include": "root.json",
+		"services": {
+			"payment": {"$include": [{"path": "payment.json", "at": "/settings"}], "includes": ["other.json"]},
+			"auth": {"$include": {"path": "auth.json", "optional": true}},
+			"list": [{"name": "a", "$include": "item.json"}, "b", [{"includes": [{"path": "c.json", "at": "/c"}]}]]
+		}
+	}`)
+
+	// the include directive and nested includes arrays keep their meaning as data unless nested includes are honoured
+	fd, err := testLoader.wrapFiledata(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []include{{path: "base.json"}}, fd.includes)
+	assert.Empty(t, fd.items)
+	assert.Equal(t, "root.json", fd.obj[includeDirective])
+
+	l := newLoader()
+	l.nestedIncludes = true
+
+	fd, err = l.wrapFiledata(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []include{
+		{path: "base.json"},
+		{path: "root.json"},
+		{path: "auth.json", optional: true, at: "/services/auth"},
+		{path: "payment.json", at: "/services/payment/settings"},
+		{path: "other.json", at: "/services/payment"},
+	}, fd.includes)
+	assert.Equal(t, map[string]interface{}{"services": map[string]interface{}{
+		"payment": map[string]interface{}{},
+		"auth":    map[string]interface{}{},
+		"list": []interface{}{
+			map[string]interface{}{"name": "a"},
+			"b",
+			[]interface{}{map[string]interface{}{}},
+		},
+	}}, fd.obj)
+
+	// the includes of array items are relative to the items
+	if assert.Len(t, fd.items, 2) {
+		assert.Equal(t, "/services/list/0", fd.items[0].ptr)
+		assert.Equal(t, []include{{path: "item.json"}}, fd.items[0].data.includes)
+		assert.Equal(t, "/services/list/2/0", fd.items[1].ptr)
+		assert.Equal(t, []include{{path: "c.json", at: "/c"}}, fd.items[1].data.includes)
+	}
+
+	// the include directive is still honoured when includes arrays are not
+	l.includes = ""
+
+	fd, err = l.wrapFiledata([]byte(`{"$include": "a.json", "includes": ["b.json"], "x": {"includes": ["c.json"]}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []include{{path: "a.json"}}, fd.includes)
+	assert.Equal(t, map[string]interface{}{
+		"includes": []interface{}{"b.json"},
+		"x":        map[string]interface{}{"includes": []interface{}{"c.json"}},
+	}, fd.obj)
+}
+
+func TestFiledata_NestedIncludesError(t *testing.T) {
+	l := newLoader()
+	l.nestedIncludes = true
+
+	for _, data := range []string{
+		`{"a": {"$include": 1}}`,
+		`{"a": {"$include": {"optional": true}}}`,
+		`{"a": {"$include": {"path": ""}}}`,
+		`{"a": {"$include": {"path": "b.json", "at": "x"}}}`,
+		`{"a": {"$include": {"path": "b.json", "patch": "other"}}}`,
+	} {
+		_, err := l.wrapFiledata([]byte(data))
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "could not extract includes (#/a/$include)", data)
+	}
+
+	_, err := l.wrapFiledata([]byte(`{"a": [{"b": {"includes": ["x.json", 1]}}]}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not extract includes (#/a[0]/b/includes)")
+}
+
+func TestConflate_NestedIncludesSchema(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml": "services:\n  auth:\n    $include:\n      path: auth.yaml\n      optinal: true\n",
+	}, WithNestedIncludes(true))
+
+	// a typo in a nested include is reported as it is for the includes array at the root
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.ErrorIs(t, err, errInvalidPerSchema)
+	assert.Contains(t, err.Error(), "could not extract includes (#/services/auth/$include)")
+	assert.Contains(t, err.Error(), "(#/0 at mem://host/main.yaml:4:7)")
+}
+
+func TestConflate_NestedIncludesInArrays(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml": "includes:\n  - base.yaml\nservices:\n  - name: payment\n    $include: payment.yaml\n" +
+			"  - name: auth\n    port: 8443\n    $include:\n      - auth.yaml\n      - path: auth-tls.yaml\n        at: /tls\n",
+		"host/base.yaml":     "services:\n  - name: base\n",
+		"host/payment.yaml":  "host: payment\nport: 1\n",
+		"host/auth.yaml":     "host: auth\nport: 1\nroutes:\n  - path: /login\n    $include: login.yaml\n",
+		"host/login.yaml":    "methods: [GET, POST]\n",
+		"host/auth-tls.yaml": "enabled: true\n",
+	}, WithNestedIncludes(true), WithProvenance(true))
+
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"services": [
+		{"name": "base"},
+		{"name": "payment", "host": "payment", "port": 1},
+		{"name": "auth", "host": "auth", "port": 8443, "tls": {"enabled": true},
+		 "routes": [{"path": "/login", "methods": ["GET", "POST"]}]}
+	]}`)), out)
+	assert.Equal(t, "mem://host/main.yaml", c.Provenance("/services/2/tls/enabled").Source)
+
+	graph, err := c.GraphFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"mem://host/base.yaml",
+		"mem://host/payment.yaml",
+		"mem://host/login.yaml",
+		"mem://host/auth.yaml",
+		"mem://host/auth-tls.yaml",
+		"mem://host/main.yaml",
+	}, graph.List())
+}
+
+func TestConflate_NestedIncludesInArraysRecursive(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json":  `{"list": [{"$include": "child.json"}]}`,
+		"host/child.json": `{"b": {"$include": "main.json"}}`,
+	}, WithNestedIncludes(true))
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.ErrorIs(t, err, errRecursiveURL)
+}
+
+func TestConflate_NestedIncludes(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml": "services:\n  payment:\n    includes:\n      - payment/main.yaml\n    port: 8080\n" +
+			"  auth:\n    $include: auth.yaml\n",
+		"host/payment/main.yaml":    "host: payment\nport: 1\ngateway:\n  $include: gateway.yaml\n",
+		"host/payment/gateway.yaml": "url: https://example.com\n",
+		"host/auth.yaml":            "host: auth\n",
+	}, WithNestedIncludes(true))
+
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+
+	var out interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"services": {
+		"payment": {"host": "payment", "port": 8080, "gateway": {"url": "https://example.com"}},
+		"auth": {"host": "auth"}
+	}}`)), out)
+}
+
+func TestConflate_NestedIncludesRecursive(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.json":  `{"services": {"a": {"$include": "child.json"}}}`,
+		"host/child.json": `{"b": {"$include": "main.json"}}`,
+	}, WithNestedIncludes(true))
+
+	err := c.AddFiles("mem://host/main.json")
+	assert.ErrorIs(t, err, errRecursiveURL)
+}
@@ -0,0 +1,405 @@
+package conflate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// iniSectionSeparator separates the keys of nested objects in a section name, as in [database.replica].
+	iniSectionSeparator = "."
+	// iniArraySuffix marks a key whose values are appended to an array, as in hosts[] = a.
+	iniArraySuffix = "[]"
+)
+
+var (
+	errINILine    = errors.New("the line is not a valid ini section or key")
+	errINISection = errors.New("the section name is not valid")
+	errINIQuote   = errors.New("the quoted value is not valid")
+
+	iniNumber = regexp.MustCompile(`^-?(?:0|[1-9][0-9]*)(?:\.[0-9]+)?(?:[eE][+-]?[0-9]+)?$`)
+)
+
+// iniEntry is a section header, or a key and value, read from an INI file.
+type iniEntry struct {
+	// section holds the keys of the section which the entry is in, or which it starts.
+	section []string
+	// key is blank for a section header.
+	key    string
+	value  string
+	quoted bool
+	array  bool
+	line   int
+	column int
+}
+
+// INIUnmarshal unmarshals the data as an INI file, in which all values are strings.
+// Keys before the first section are at the top level, and each section is an object nested at each dot of its name,
+// so that [database.replica] is {"database": {"replica": {...}}}. Keys ending with [] are appended to an array.
+// See NewINIUnmarshaller to detect numbers and booleans.
+func INIUnmarshal(data []byte, out interface{}) error {
+	return unmarshalINI(data, out, false)
+}
+
+// NewINIUnmarshaller returns a function that unmarshals INI files as INIUnmarshal does.
+// If typed is true then unquoted values which are JSON numbers or booleans are unmarshalled as such.
+func NewINIUnmarshaller(typed bool) UnmarshallerFunc {
+	return func(data []byte, out interface{}) error {
+		return unmarshalINI(data, out, typed)
+	}
+}
+
+func unmarshalINI(data []byte, out interface{}, typed bool) error {
+	entries, err := parseINI(data)
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as ini: %w", err)
+	}
+
+	obj, err := nestINI(entries, typed, nil, "")
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as ini: %w", err)
+	}
+
+	return jsonMarshalUnmarshal(obj, out)
+}
+
+// nestINI builds the object described by the INI entries, recording their positions if pos is not nil.
+func nestINI(entries []iniEntry, typed bool, pos positions, source string) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+
+	for _, entry := range entries {
+		parent := obj
+		ctx := rootContext()
+
+		for _, key := range entry.section {
+			ctx = ctx.add(key)
+
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return nil, fmt.Errorf("%w : %v", errFlatConflict, ctx)
+				}
+
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+
+			parent = child
+		}
+
+		if entry.key == "" {
+			if pos != nil {
+				pos[ctx.pointer()] = position{source: source, line: entry.line, column: entry.column}
+			}
+
+			continue
+		}
+
+		ctx = ctx.add(entry.key)
+		value := iniValue(entry, typed)
+
+		if entry.array {
+			items, ok := parent[entry.key].([]interface{})
+			if !ok && parent[entry.key] != nil {
+				return nil, fmt.Errorf("%w : %v", errFlatConflict, ctx)
+			}
+
+			ctx = ctx.addInt(len(items))
+			parent[entry.key] = append(items, value)
+		} else {
+			if _, ok := parent[entry.key].(map[string]interface{}); ok {
+				return nil, fmt.Errorf("%w : %v", errFlatConflict, ctx)
+			}
+
+			parent[entry.key] = value
+		}
+
+		if pos != nil {
+			pos[ctx.pointer()] = position{source: source, line: entry.line, column: entry.column}
+		}
+	}
+
+	return obj, nil
+}
+
+// iniValue returns the value of the entry, detecting numbers and booleans in unquoted values if typed is true.
+func iniValue(entry iniEntry, typed bool) interface{} {
+	if !typed || entry.quoted {
+		return entry.value
+	}
+
+	if iniNumber.MatchString(entry.value) {
+		if f, err := strconv.ParseFloat(entry.value, 64); err == nil {
+			return f
+		}
+	}
+
+	switch strings.ToLower(entry.value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	return entry.value
+}
+
+// locateINIPositions finds the positions of the sections and values of an INI file.
+func locateINIPositions(data []byte, source string) positions {
+	entries, err := parseINI(data)
+	if err != nil {
+		return nil
+	}
+
+	pos := positions{"": {source: source, line: 1, column: 1}}
+
+	_, err = nestINI(entries, false, pos, source)
+	if err != nil {
+		return nil
+	}
+
+	return pos
+}
+
+// parseINI reads the section headers and keys of an INI file. Keys are separated from their values by = or :,
+// and lines or the rest of a line after whitespace starting with ; or # are comments.
+// Values may be double quoted to allow escapes such as \n, or single quoted to be read literally.
+func parseINI(data []byte) ([]iniEntry, error) {
+	var (
+		entries []iniEntry
+		section []string
+	)
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#' {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+
+		if trimmed[0] == '[' {
+			end := strings.Index(trimmed, "]")
+			if end < 0 || iniStripComment(trimmed[end+1:]) != "" {
+				return nil, fmt.Errorf("%w : line %v", errINILine, lineNo)
+			}
+
+			section = nil
+
+			for _, key := range strings.Split(trimmed[1:end], iniSectionSeparator) {
+				key = strings.TrimSpace(key)
+				if key == "" {
+					return nil, fmt.Errorf("%w : line %v", errINISection, lineNo)
+				}
+
+				section = append(section, key)
+			}
+
+			entries = append(entries, iniEntry{section: section, line: lineNo, column: indent + 1})
+
+			continue
+		}
+
+		sep := strings.IndexAny(trimmed, "=:")
+		if sep < 0 {
+			sep = len(trimmed)
+		}
+
+		key := strings.TrimSpace(trimmed[:sep])
+		key, array := strings.CutSuffix(key, iniArraySuffix)
+
+		if key == "" {
+			return nil, fmt.Errorf("%w : line %v", errINILine, lineNo)
+		}
+
+		entry := iniEntry{section: section, key: key, array: array, line: lineNo, column: indent + len(trimmed) + 1}
+
+		if sep < len(trimmed) {
+			raw := strings.TrimLeft(trimmed[sep+1:], " \t")
+			entry.column = indent + len(trimmed) - len(raw) + 1
+
+			value, quoted, err := iniUnquote(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w : line %v", err, lineNo)
+			}
+
+			entry.value = value
+			entry.quoted = quoted
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// iniUnquote returns the value, without its quotes or any comment, and whether it was quoted.
+func iniUnquote(value string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		prefix, err := strconv.QuotedPrefix(value)
+		if err != nil || iniStripComment(value[len(prefix):]) != "" {
+			return "", false, errINIQuote
+		}
+
+		unquoted, err := strconv.Unquote(prefix)
+		if err != nil {
+			return "", false, errINIQuote
+		}
+
+		return unquoted, true, nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 || iniStripComment(value[end+2:]) != "" {
+			return "", false, errINIQuote
+		}
+
+		return value[1 : end+1], true, nil
+	}
+
+	return iniStripComment(value), false, nil
+}
+
+// iniStripComment removes any comment, which starts at a ; or # at the start of the text or after whitespace.
+func iniStripComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		if (text[i] == ';' || text[i] == '#') && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t') {
+			text = text[:i]
+
+			break
+		}
+	}
+
+	return strings.TrimSpace(text)
+}
+
+func iniMarshal(in interface{}) ([]byte, error) {
+	var data interface{}
+
+	err := jsonMarshalUnmarshal(in, &data)
+	if err != nil {
+		return nil, fmt.Errorf("the data could not be marshalled to ini: %w", err)
+	}
+
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the data could not be marshalled to ini: %w", errFlatNotObject)
+	}
+
+	var buf bytes.Buffer
+
+	err = iniMarshalSection(&buf, nil, obj)
+	if err != nil {
+		return nil, fmt.Errorf("the data could not be marshalled to ini: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// iniMarshalSection writes the keys of the object, under a section header unless it is the top level,
+// followed by the sections of its nested objects.
+func iniMarshalSection(buf *bytes.Buffer, section []string, obj map[string]interface{}) error {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var children []string
+
+	for _, name := range names {
+		if _, ok := obj[name].(map[string]interface{}); ok {
+			children = append(children, name)
+		}
+	}
+
+	// an object which holds only other objects needs no header, as its sections create it
+	if len(section) > 0 && (len(children) < len(names) || len(names) == 0) {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+
+		fmt.Fprintf(buf, "[%v]\n", strings.Join(section, iniSectionSeparator))
+	}
+
+	for _, name := range names {
+		if _, ok := obj[name].(map[string]interface{}); ok {
+			continue
+		}
+
+		if !iniValidKey(name) {
+			return fmt.Errorf("%w : %v", errFlatKey, name)
+		}
+
+		items, isArray := obj[name].([]interface{})
+		if !isArray {
+			items = []interface{}{obj[name]}
+		}
+
+		for _, item := range items {
+			value, err := iniFormat(item)
+			if err != nil {
+				return err
+			}
+
+			if isArray {
+				fmt.Fprintf(buf, "%v%v = %v\n", name, iniArraySuffix, value)
+			} else {
+				fmt.Fprintf(buf, "%v = %v\n", name, value)
+			}
+		}
+	}
+
+	for _, name := range children {
+		if strings.ContainsAny(name, iniSectionSeparator+"[]") || !iniValidKey(name) {
+			return fmt.Errorf("%w : %v", errFlatKey, name)
+		}
+
+		child, _ := obj[name].(map[string]interface{})
+
+		err := iniMarshalSection(buf, append(section[:len(section):len(section)], name), child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// iniValidKey reports whether the key would be read back the same.
+func iniValidKey(key string) bool {
+	return key != "" && key == strings.TrimSpace(key) && !strings.ContainsAny(key, "=:;#\n\r") &&
+		!strings.HasPrefix(key, "[") && !strings.HasSuffix(key, iniArraySuffix)
+}
+
+// iniFormat formats a scalar value, quoting strings which would not otherwise be read back the same,
+// including those which would be read as numbers or booleans by a typed unmarshaller.
+func iniFormat(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		typed := iniValue(iniEntry{value: v}, true)
+		if _, ok := typed.(string); !ok || v != iniStripComment(v) || strings.HasPrefix(v, `"`) ||
+			strings.HasPrefix(v, "'") || strings.ContainsAny(v, "\n\r") {
+			return strconv.Quote(v), nil
+		}
+
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w : %T", errUnsupportedVal, value)
+	}
+}
@@ -0,0 +1,186 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testINI = `; vendor config
+name = app
+debug
+
+[database]
+host = localhost ; the primary
+port = 5432
+password = "p;ss\n" # quoted
+user: 'admin'
+
+[database.replica]
+  host=replica
+  hosts[] = a
+  hosts[] = b
+
+[empty]
+`
+
+func TestINIUnmarshal(t *testing.T) {
+	var out interface{}
+
+	err := INIUnmarshal([]byte(testINI), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":  "app",
+		"debug": "",
+		"database": map[string]interface{}{
+			"host":     "localhost",
+			"port":     "5432",
+			"password": "p;ss\n",
+			"user":     "admin",
+			"replica": map[string]interface{}{
+				"host":  "replica",
+				"hosts": []interface{}{"a", "b"},
+			},
+		},
+		"empty": map[string]interface{}{},
+	}, out)
+}
+
+func TestINIUnmarshal_Typed(t *testing.T) {
+	var out interface{}
+
+	err := NewINIUnmarshaller(true)([]byte("a = 1.5e3\nb = TRUE\nc = \"2\"\nd = 0755\ne = -3\nf = false\ng = 1.\n"), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": 1500.0,
+		"b": true,
+		"c": "2",
+		"d": "0755",
+		"e": -3.0,
+		"f": false,
+		"g": "1.",
+	}, out)
+}
+
+func TestINIUnmarshal_Error(t *testing.T) {
+	for _, data := range []string{
+		"[a",
+		"[a] b",
+		"[a..b]",
+		"= x",
+		`a = "x`,
+		`a = "x" y`,
+		"a = 'x",
+		"a = 1\n[a]",
+		"[a]\n[a.b]\n[x]\na.b = 1\n[a]\nb = 1",
+		"a = 1\na[] = 2",
+	} {
+		var out interface{}
+
+		err := INIUnmarshal([]byte(data), &out)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "the data could not be unmarshalled as ini", data)
+	}
+}
+
+func TestLocateINIPositions(t *testing.T) {
+	pos := locatePositions([]byte(testINI), "x.ini", ".ini")
+	assert.Equal(t, position{source: "x.ini", line: 2, column: 8}, pos["/name"])
+	assert.Equal(t, position{source: "x.ini", line: 3, column: 6}, pos["/debug"])
+	assert.Equal(t, position{source: "x.ini", line: 5, column: 1}, pos["/database"])
+	assert.Equal(t, position{source: "x.ini", line: 9, column: 7}, pos["/database/user"])
+	assert.Equal(t, position{source: "x.ini", line: 11, column: 1}, pos["/database/replica"])
+	assert.Equal(t, position{source: "x.ini", line: 12, column: 8}, pos["/database/replica/host"])
+	assert.Equal(t, position{source: "x.ini", line: 14, column: 13}, pos["/database/replica/hosts/1"])
+
+	assert.Nil(t, locatePositions([]byte("[a"), "x.ini", ".ini"))
+}
+
+func TestINIMarshal(t *testing.T) {
+	data := map[string]interface{}{
+		"name": "app",
+		"none": nil,
+		"database": map[string]interface{}{
+			"host":     "localhost",
+			"port":     5432.0,
+			"ssl":      true,
+			"version":  "5432",
+			"password": " p;ss\n",
+			"replica": map[string]interface{}{
+				"hosts": []interface{}{"a", "b"},
+			},
+		},
+		"outer": map[string]interface{}{
+			"inner": map[string]interface{}{},
+		},
+	}
+
+	out, err := iniMarshal(data)
+	assert.Nil(t, err)
+	assert.Equal(t, `name = app
+none = 
+
+[database]
+host = localhost
+password = " p;ss\n"
+port = 5432
+ssl = true
+version = "5432"
+
+[database.replica]
+hosts[] = a
+hosts[] = b
+
+[outer.inner]
+`, string(out))
+
+	var back interface{}
+
+	err = NewINIUnmarshaller(true)(out, &back)
+	assert.Nil(t, err)
+
+	data["none"] = ""
+	assert.Equal(t, data, back)
+}
+
+func TestINIMarshal_Error(t *testing.T) {
+	for _, data := range []interface{}{
+		[]interface{}{"a"},
+		map[string]interface{}{"a=b": 1},
+		map[string]interface{}{"a[]": 1},
+		map[string]interface{}{"a.b": map[string]interface{}{"c": 1}},
+		map[string]interface{}{"a": []interface{}{map[string]interface{}{}}},
+		map[string]interface{}{"a": func() {}},
+	} {
+		_, err := iniMarshal(data)
+		assert.NotNil(t, err, data)
+		assert.Contains(t, err.Error(), "the data could not be marshalled to ini")
+	}
+}
+
+func TestConflate_INI(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/main.yaml":  "includes:\n  - vendor.ini\ndatabase:\n  port: 6543\n",
+		"host/vendor.ini": "[database]\nhost = localhost\nport = 5432\n\n[database.replica]\nenabled = true\n",
+	}, WithINITypes(true))
+
+	err := c.AddFiles("mem://host/main.yaml")
+	assert.Nil(t, err)
+
+	out, err := c.MarshalINI()
+	assert.Nil(t, err)
+	assert.Equal(t, "[database]\nhost = localhost\nport = 6543\n\n[database.replica]\nenabled = true\n", string(out))
+
+	c = testMemConflate(map[string]string{
+		"host/vendor.ini": "port = 5432\n",
+	}, WithINITypes(false))
+
+	err = c.AddFiles("mem://host/vendor.ini")
+	assert.Nil(t, err)
+
+	var data map[string]interface{}
+
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, "5432", data["port"])
+}
@@ -0,0 +1,597 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	errJSON5Unexpected = errors.New("unexpected character")
+	errJSON5EOF        = errors.New("unexpected end of input")
+	errJSON5Comment    = errors.New("the comment is not terminated")
+	errJSON5Number     = errors.New("the number is not valid")
+	errJSON5NonFinite  = errors.New("the number cannot be represented in json")
+	errJSON5Escape     = errors.New("the escape sequence is not valid")
+	errJSON5Depth      = errors.New("the data is nested too deeply")
+
+	json5Decimal = regexp.MustCompile(`^(?:(?:0|[1-9][0-9]*)(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?$`)
+	json5Hex     = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+)
+
+// json5MaxDepth limits the nesting of objects and arrays, as encoding/json does, so that the recursion is bounded.
+const json5MaxDepth = 10000
+
+// JSON5Unmarshal unmarshals the data as JSON5, which extends JSON with comments, trailing commas, unquoted keys,
+// single quoted strings, and hexadecimal numbers, amongst others. It therefore also unmarshals JSON with comments.
+// Errors report the line and column at which the data is not valid.
+func JSON5Unmarshal(data []byte, out interface{}) error {
+	p := newJSON5Parser(data, nil, "")
+
+	value, err := p.parse()
+	if err != nil {
+		return fmt.Errorf("the data could not be unmarshalled as json5: %w", err)
+	}
+
+	return jsonMarshalUnmarshal(value, out)
+}
+
+// locateJSON5Positions finds the positions of the values within JSON5 data, reporting false if it cannot be parsed.
+func locateJSON5Positions(data []byte, source string) (positions, bool) {
+	pos := positions{}
+
+	_, err := newJSON5Parser(data, pos, source).parse()
+	if err != nil {
+		return nil, false
+	}
+
+	return pos, true
+}
+
+// json5Parser is a recursive descent parser of JSON5, which records the position of each value if pos is not nil.
+// The JSON5 decoders for go neither report the positions of the values nor the line and column of errors,
+// which the same parser does here for both, and it is checked against encoding/json by FuzzJSON5Unmarshal.
+type json5Parser struct {
+	data   []byte
+	offset int
+	line   int
+	column int
+	depth  int
+	pos    positions
+	source string
+}
+
+func newJSON5Parser(data []byte, pos positions, source string) *json5Parser {
+	return &json5Parser{data: data, line: 1, column: 1, pos: pos, source: source}
+}
+
+func (p *json5Parser) parse() (interface{}, error) {
+	value, err := p.parseValue(rootContext())
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.skipSpace()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.offset < len(p.data) {
+		return nil, p.unexpected()
+	}
+
+	return value, nil
+}
+
+func (p *json5Parser) position() position {
+	return position{source: p.source, line: p.line, column: p.column}
+}
+
+// errorf reports the error at the current position.
+func (p *json5Parser) errorf(err error) error {
+	return errorAt(err, p.position())
+}
+
+// errorAt reports the error at the position, whose source is left to be reported by the caller.
+func errorAt(err error, pos position) error {
+	return fmt.Errorf("%w at %v", err, position{line: pos.line, column: pos.column})
+}
+
+func (p *json5Parser) unexpected() error {
+	r := p.peek()
+	if r == utf8.RuneError && p.offset >= len(p.data) {
+		return p.errorf(errJSON5EOF)
+	}
+
+	return p.errorf(fmt.Errorf("%w %q", errJSON5Unexpected, r))
+}
+
+// peek returns the next rune, or utf8.RuneError at the end of the data.
+func (p *json5Parser) peek() rune {
+	r, _ := utf8.DecodeRune(p.data[p.offset:])
+
+	return r
+}
+
+func (p *json5Parser) next() rune {
+	r, size := utf8.DecodeRune(p.data[p.offset:])
+	p.offset += size
+
+	switch {
+	case r == '\r' && p.peek() == '\n':
+		p.column++
+	case isJSON5LineTerminator(r):
+		p.line++
+		p.column = 1
+	default:
+		p.column++
+	}
+
+	return r
+}
+
+// expect consumes the given rune, or fails if it is not next.
+func (p *json5Parser) expect(r rune) error {
+	if p.peek() != r || p.offset >= len(p.data) {
+		return p.unexpected()
+	}
+
+	p.next()
+
+	return nil
+}
+
+func isJSON5LineTerminator(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\u2028' || r == '\u2029'
+}
+
+func isJSON5Space(r rune) bool {
+	return r == '\t' || r == '\v' || r == '\f' || r == ' ' || r == '\u00a0' || r == '\ufeff' ||
+		isJSON5LineTerminator(r) || unicode.Is(unicode.Zs, r)
+}
+
+func isJSON5IDStart(r rune) bool {
+	return r == '$' || r == '_' || unicode.IsLetter(r) || unicode.Is(unicode.Nl, r)
+}
+
+func isJSON5IDPart(r rune) bool {
+	return isJSON5IDStart(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc) ||
+		r == '\u200c' || r == '\u200d'
+}
+
+// skipSpace skips any whitespace and comments.
+func (p *json5Parser) skipSpace() error {
+	for p.offset < len(p.data) {
+		r := p.peek()
+
+		switch {
+		case isJSON5Space(r):
+			p.next()
+		case r == '/' && p.offset+1 < len(p.data) && p.data[p.offset+1] == '/':
+			for p.offset < len(p.data) && !isJSON5LineTerminator(p.peek()) {
+				p.next()
+			}
+		case r == '/' && p.offset+1 < len(p.data) && p.data[p.offset+1] == '*':
+			start := p.position()
+
+			p.next()
+			p.next()
+
+			end := strings.Index(string(p.data[p.offset:]), "*/")
+			if end < 0 {
+				return errorAt(errJSON5Comment, start)
+			}
+
+			for stop := p.offset + end + 2; p.offset < stop; {
+				p.next()
+			}
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (p *json5Parser) parseValue(ctx context) (interface{}, error) {
+	err := p.skipSpace()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != nil {
+		p.pos[ctx.pointer()] = p.position()
+	}
+
+	if p.offset >= len(p.data) {
+		return nil, p.errorf(errJSON5EOF)
+	}
+
+	switch r := p.peek(); {
+	case r == '{' || r == '[':
+		return p.parseNested(ctx, r)
+	case r == '"' || r == '\'':
+		return p.parseString()
+	case r == '+' || r == '-' || r == '.' || (r >= '0' && r <= '9'):
+		return p.parseNumber()
+	case isJSON5IDStart(r):
+		return p.parseLiteral()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// parseNested parses an object or an array, failing if they are nested too deeply.
+func (p *json5Parser) parseNested(ctx context, r rune) (interface{}, error) {
+	if p.depth >= json5MaxDepth {
+		return nil, p.errorf(errJSON5Depth)
+	}
+
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if r == '{' {
+		return p.parseObject(ctx)
+	}
+
+	return p.parseArray(ctx)
+}
+
+func (p *json5Parser) parseObject(ctx context) (interface{}, error) {
+	obj := map[string]interface{}{}
+
+	p.next()
+
+	for {
+		err := p.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() == '}' {
+			p.next()
+
+			return obj, nil
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect(':')
+		if err != nil {
+			return nil, err
+		}
+
+		obj[key], err = p.parseValue(ctx.add(key))
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ',' {
+			return obj, p.expect('}')
+		}
+
+		p.next()
+	}
+}
+
+func (p *json5Parser) parseArray(ctx context) (interface{}, error) {
+	arr := []interface{}{}
+
+	p.next()
+
+	for {
+		err := p.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() == ']' {
+			p.next()
+
+			return arr, nil
+		}
+
+		item, err := p.parseValue(ctx.addInt(len(arr)))
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, item)
+
+		err = p.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ',' {
+			return arr, p.expect(']')
+		}
+
+		p.next()
+	}
+}
+
+// parseKey parses an object key, which is either a string or an identifier.
+func (p *json5Parser) parseKey() (string, error) {
+	r := p.peek()
+	if r == '"' || r == '\'' {
+		return p.parseString()
+	}
+
+	var sb strings.Builder
+
+	for p.offset < len(p.data) {
+		r = p.peek()
+
+		if r == '\\' {
+			start := p.position()
+
+			p.next()
+
+			if p.peek() != 'u' {
+				return "", errorAt(errJSON5Escape, start)
+			}
+
+			p.next()
+
+			r, err := p.parseHex(4)
+			if err != nil {
+				return "", err
+			}
+
+			if !isJSON5IDPart(r) || (sb.Len() == 0 && !isJSON5IDStart(r)) {
+				return "", errorAt(errJSON5Escape, start)
+			}
+
+			sb.WriteRune(r)
+
+			continue
+		}
+
+		if !isJSON5IDPart(r) || (sb.Len() == 0 && !isJSON5IDStart(r)) {
+			break
+		}
+
+		sb.WriteRune(p.next())
+	}
+
+	if sb.Len() == 0 {
+		return "", p.unexpected()
+	}
+
+	return sb.String(), nil
+}
+
+func (p *json5Parser) parseString() (string, error) {
+	quote := p.next()
+
+	var sb strings.Builder
+
+	for {
+		if p.offset >= len(p.data) {
+			return "", p.errorf(errJSON5EOF)
+		}
+
+		r := p.peek()
+
+		switch {
+		case r == quote:
+			p.next()
+
+			return sb.String(), nil
+		case r == '\n' || r == '\r':
+			return "", p.unexpected()
+		case r == '\\':
+			err := p.parseEscape(&sb)
+			if err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteRune(p.next())
+		}
+	}
+}
+
+func (p *json5Parser) parseEscape(sb *strings.Builder) error {
+	start := p.position()
+	escapeError := errorAt(errJSON5Escape, start)
+
+	p.next()
+
+	if p.offset >= len(p.data) {
+		return p.errorf(errJSON5EOF)
+	}
+
+	r := p.next()
+
+	switch r {
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case 't':
+		sb.WriteByte('\t')
+	case 'v':
+		sb.WriteByte('\v')
+	case '0':
+		if d := p.peek(); d >= '0' && d <= '9' {
+			return escapeError
+		}
+
+		sb.WriteByte(0)
+	case 'x':
+		h, err := p.parseHex(2)
+		if err != nil {
+			return err
+		}
+
+		sb.WriteRune(h)
+	case 'u':
+		h, err := p.parseHex(4)
+		if err != nil {
+			return err
+		}
+
+		// a surrogate pair is escaped as two \u escapes
+		if h >= 0xd800 && h < 0xdc00 && strings.HasPrefix(string(p.data[p.offset:]), `\u`) {
+			p.next()
+			p.next()
+
+			low, err := p.parseHex(4)
+			if err != nil {
+				return err
+			}
+
+			h = utf16.DecodeRune(h, low)
+		}
+
+		sb.WriteRune(h)
+	case '\r':
+		// a line continuation, in which \r\n is a single line terminator
+		if p.peek() == '\n' {
+			p.next()
+		}
+	case '\n', '\u2028', '\u2029':
+	default:
+		if r >= '1' && r <= '9' {
+			return escapeError
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return nil
+}
+
+// parseHex parses the given number of hexadecimal digits as a rune.
+func (p *json5Parser) parseHex(digits int) (rune, error) {
+	start := p.position()
+
+	if p.offset+digits > len(p.data) {
+		return 0, errorAt(errJSON5Escape, start)
+	}
+
+	n, err := strconv.ParseUint(string(p.data[p.offset:p.offset+digits]), 16, 32)
+	if err != nil {
+		return 0, errorAt(errJSON5Escape, start)
+	}
+
+	for i := 0; i < digits; i++ {
+		p.next()
+	}
+
+	return rune(n), nil
+}
+
+func (p *json5Parser) parseNumber() (interface{}, error) {
+	start := p.position()
+	numberError := errorAt(errJSON5Number, start)
+
+	sign := 1.0
+
+	switch p.peek() {
+	case '-':
+		sign = -1
+
+		p.next()
+	case '+':
+		p.next()
+	}
+
+	if isJSON5IDStart(p.peek()) {
+		word := p.parseWord()
+		if word == "Infinity" || word == "NaN" {
+			return nil, errorAt(errJSON5NonFinite, start)
+		}
+
+		return nil, numberError
+	}
+
+	var sb strings.Builder
+
+	for p.offset < len(p.data) {
+		r := p.peek()
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || strings.ContainsRune(".xX+-", r)) {
+			break
+		}
+
+		// a sign may only follow an exponent
+		if (r == '+' || r == '-') && !strings.HasSuffix(sb.String(), "e") && !strings.HasSuffix(sb.String(), "E") {
+			break
+		}
+
+		sb.WriteRune(p.next())
+	}
+
+	text := sb.String()
+
+	switch {
+	case json5Hex.MatchString(text):
+		n, err := strconv.ParseUint(text[2:], 16, 64)
+		if err != nil {
+			return nil, numberError
+		}
+
+		return sign * float64(n), nil
+	case json5Decimal.MatchString(text):
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, numberError
+		}
+
+		return sign * f, nil
+	default:
+		return nil, numberError
+	}
+}
+
+// parseWord parses the identifier characters of a literal.
+func (p *json5Parser) parseWord() string {
+	var sb strings.Builder
+
+	for p.offset < len(p.data) && isJSON5IDPart(p.peek()) {
+		sb.WriteRune(p.next())
+	}
+
+	return sb.String()
+}
+
+func (p *json5Parser) parseLiteral() (interface{}, error) {
+	start := p.position()
+
+	switch word := p.parseWord(); word {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "Infinity", "NaN":
+		return nil, errorAt(errJSON5NonFinite, start)
+	default:
+		return nil, errorAt(fmt.Errorf("%w %q", errJSON5Unexpected, word), start)
+	}
+}
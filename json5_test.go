@@ -0,0 +1,182 @@
+package conflate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJSON5 = `// a hand edited config
+{
+  name: 'app', /* the name
+  of the app */
+  "port": 8080,
+  hex: 0xFF,
+  ratio: .5,
+  whole: 5.,
+  big: +1e3,
+  neg: -0x10,
+  $id_2: null,
+  flags: [true, false,],
+  quote: "it's \"quoted\"\n\x41é😀\
+ continued",
+  nested: {a: {b: [1, {c: 'd'}]}},
+}
+`
+
+func TestJSON5Unmarshal(t *testing.T) {
+	var out interface{}
+
+	err := JSON5Unmarshal([]byte(testJSON5), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":  "app",
+		"port":  8080.0,
+		"hex":   255.0,
+		"ratio": 0.5,
+		"whole": 5.0,
+		"big":   1000.0,
+		"neg":   -16.0,
+		"$id_2": nil,
+		"flags": []interface{}{true, false},
+		"quote": "it's \"quoted\"\nAé😀 continued",
+		"nested": map[string]interface{}{
+			"a": map[string]interface{}{"b": []interface{}{1.0, map[string]interface{}{"c": "d"}}},
+		},
+	}, out)
+}
+
+func TestJSON5Unmarshal_JSON(t *testing.T) {
+	data := []byte(`{"a": [1, 2.5e-3, "x\té"], "b": {"c": null, "d": true}, "": -0}`)
+
+	var json5Out, jsonOut interface{}
+
+	err := JSON5Unmarshal(data, &json5Out)
+	assert.Nil(t, err)
+
+	err = JSONUnmarshal(data, &jsonOut)
+	assert.Nil(t, err)
+	assert.Equal(t, jsonOut, json5Out)
+}
+
+// FuzzJSON5Unmarshal checks that JSON5Unmarshal unmarshals any JSON as encoding/json does,
+// and that it does not fail to locate the positions within data that it unmarshals.
+func FuzzJSON5Unmarshal(f *testing.F) {
+	f.Add([]byte(testJSON5))
+	f.Add([]byte(`{"a": [1, 2.5e-3, "x\té\u00e9\ud83d\ude00"], "b": {"c": null, "d": true}, "": -0}`))
+	f.Add([]byte(`[1e308, -1E-5, 0.0, "\"\\\/\b\f\n\r\t", {"a": 1, "a": 2}]`))
+	f.Add([]byte(" \t\r\n\"\xff\" "))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var json5Out interface{}
+
+		json5Err := JSON5Unmarshal(data, &json5Out)
+		if json5Err == nil {
+			_, ok := locateJSON5Positions(data, "")
+			assert.True(t, ok, "%q", data)
+		}
+
+		var jsonOut interface{}
+
+		if json.Unmarshal(data, &jsonOut) != nil {
+			return
+		}
+
+		if assert.Nil(t, json5Err, "%q", data) {
+			assert.Equal(t, jsonOut, json5Out, "%q", data)
+		}
+	})
+}
+
+func TestJSON5Unmarshal_Error(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{data: "", err: "unexpected end of input at 1:1"},
+		{data: "{\n  a: 1\n  b: 2\n}", err: "unexpected character 'b' at 3:3"},
+		{data: "{a: 1,, }", err: "unexpected character ',' at 1:7"},
+		{data: "[1 2]", err: "unexpected character '2' at 1:4"},
+		{data: "{a 1}", err: "unexpected character '1' at 1:4"},
+		{data: "{1: 1}", err: "unexpected character '1' at 1:2"},
+		{data: "{a: 1} x", err: "unexpected character 'x' at 1:8"},
+		{data: "{a: 1", err: "unexpected end of input at 1:6"},
+		{data: "{a: undefined}", err: `unexpected character "undefined" at 1:5`},
+		{data: "/* x", err: "the comment is not terminated at 1:1"},
+		{data: "\n  'abc", err: "unexpected end of input at 2:7"},
+		{data: "'a\nb'", err: "unexpected character '\\n' at 1:3"},
+		{data: `'\01'`, err: "the escape sequence is not valid at 1:2"},
+		{data: `'\1'`, err: "the escape sequence is not valid at 1:2"},
+		{data: `'\u12'`, err: "the escape sequence is not valid at 1:4"},
+		{data: `'\xzz'`, err: "the escape sequence is not valid at 1:4"},
+		{data: `{\x61: 1}`, err: "the escape sequence is not valid at 1:2"},
+		{data: "01", err: "the number is not valid at 1:1"},
+		{data: "1.2.3", err: "the number is not valid at 1:1"},
+		{data: "0x", err: "the number is not valid at 1:1"},
+		{data: "1e999", err: "the number is not valid at 1:1"},
+		{data: "-foo", err: "the number is not valid at 1:1"},
+		{data: "[1, -Infinity]", err: "the number cannot be represented in json at 1:5"},
+		{data: "NaN", err: "the number cannot be represented in json at 1:1"},
+		{data: strings.Repeat("[", json5MaxDepth+1), err: "the data is nested too deeply at 1:10001"},
+	}
+
+	for _, tt := range tests {
+		var out interface{}
+
+		err := JSON5Unmarshal([]byte(tt.data), &out)
+		if assert.NotNil(t, err, tt.data) {
+			assert.Equal(t, "the data could not be unmarshalled as json5: "+tt.err, err.Error(), tt.data)
+		}
+	}
+}
+
+func TestLocateJSON5Positions(t *testing.T) {
+	pos := locatePositions([]byte(testJSON5), "x.json5", ".json5")
+	assert.Equal(t, position{source: "x.json5", line: 2, column: 1}, pos[""])
+	assert.Equal(t, position{source: "x.json5", line: 3, column: 9}, pos["/name"])
+	assert.Equal(t, position{source: "x.json5", line: 5, column: 11}, pos["/port"])
+	assert.Equal(t, position{source: "x.json5", line: 12, column: 17}, pos["/flags/1"])
+	assert.Equal(t, position{source: "x.json5", line: 15, column: 27}, pos["/nested/a/b/1/c"])
+
+	pos = locatePositions([]byte("// comment\n{\"a\": 1}"), "x.json", ".json")
+	assert.Equal(t, position{source: "x.json", line: 2, column: 7}, pos["/a"])
+
+	assert.Nil(t, locatePositions([]byte("{"), "x.jsonc", ".jsonc"))
+}
+
+func TestConflate_LenientJSON(t *testing.T) {
+	files := map[string]string{
+		"host/main.json":      "{\n  // the defaults\n  includes: ['defaults.jsonc'],\n  port: 8080,\n}\n",
+		"host/defaults.jsonc": "{\"host\": \"localhost\", /* default */ \"port\": 80,}",
+	}
+
+	c := testMemConflate(files)
+	err := c.AddFiles("mem://host/main.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the data could not be unmarshalled as json")
+
+	c = testMemConflate(files, WithLenientJSON(true))
+	err = c.AddFiles("mem://host/main.json")
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "localhost", "port": 8080.0}, out)
+
+	c = testMemConflate(map[string]string{
+		"host/bad.json": "{\n  port: 8080\n  host: 'localhost'\n}\n",
+	}, WithLenientJSON(true))
+	err = c.AddFiles("mem://host/bad.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the data could not be unmarshalled as json5: unexpected character 'h' at 3:3")
+
+	assert.Len(t, c.loader.unmarshallers[".json"], 2)
+
+	c.LenientJSON(false)
+	assert.Len(t, c.loader.unmarshallers[".json"], 1)
+	assert.Len(t, c.loader.unmarshallers[".jsonc"], 1)
+}
@@ -1,7 +1,7 @@
 package conflate
 
 import (
-	ctx "context"
+	gocontext "context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +13,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -26,49 +27,227 @@ var (
 	getwd       = os.Getwd
 	driveLetter = regexp.MustCompile(`^[A-Za-z]:.*$`)
 
+	// httpClient loads http urls by default, sharing its transport so that idle connections are reused.
+	httpClient = &http.Client{Transport: newTransport()}
+
 	errBlankFilePath = errors.New("the file path is blank")
 	errFailedToLoad  = errors.New("failed to load url")
 	errRecursiveURL  = errors.New("the url recursively includes itself")
+	errNoLoader      = errors.New("no loader is registered for the url scheme")
 )
 
+// Loader defines the interface used to load the raw data held at a url.
+// Implementations should abandon the load and return an error once ctx is done.
+type Loader interface {
+	Load(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error)
+}
+
+// LoaderFunc is an adapter to allow the use of an ordinary function as a Loader.
+type LoaderFunc func(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error)
+
+// Load calls f(ctx, url).
+func (f LoaderFunc) Load(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	return f(ctx, url)
+}
+
+// LoaderMap defines the type of a map of url scheme to Loader.
+type LoaderMap map[string]Loader
+
+// Loaders is a list of loaders to be used for given url schemes.
+// The loader for the blank scheme is used when no match is found.
+var Loaders = LoaderMap{
+	"file": fileLoader{},
+	"gs":   bucketLoader{},
+	"":     LoaderFunc(loadHTTP),
+}
+
+func lookupLoader(scheme string, maps ...LoaderMap) (Loader, error) {
+	scheme = strings.ToLower(scheme)
+
+	for _, key := range []string{scheme, ""} {
+		for _, m := range maps {
+			if l, ok := m[key]; ok && l != nil {
+				return l, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w : %q", errNoLoader, scheme)
+}
+
+const defaultConcurrency = 8
+
 type loader struct {
-	newFiledata func([]byte, *pkgurl.URL) (filedata, error)
+	includes      string
+	unmarshallers UnmarshallerMap
+	// customUnmarshallers is set if the unmarshallers were given by WithUnmarshallers, so options do not change them.
+	customUnmarshallers bool
+	expand              bool
+	// nestedIncludes honours includes arrays in nested objects, as well as at the top level.
+	nestedIncludes bool
+	// documents selects the documents of YAML streams which are merged, or all of them if nil.
+	documents DocumentSelector
+	// patchSuffixes applies files named like prod.merge-patch.yaml as patches, as well as those included as patches.
+	patchSuffixes bool
+	loaders       LoaderMap
+	concurrency   int
 }
 
-func (l *loader) loadURLsRecursive(parentUrls []*pkgurl.URL, urls ...*pkgurl.URL) (filedatas, error) {
+func newLoader() loader {
+	unmarshallers := UnmarshallerMap{}
+	for ext, funcs := range Unmarshallers {
+		unmarshallers[ext] = funcs
+	}
+
+	return loader{
+		includes:      Includes,
+		unmarshallers: unmarshallers,
+		loaders:       LoaderMap{},
+		concurrency:   defaultConcurrency,
+	}
+}
+
+func (l *loader) loadURL(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	ldr, err := lookupLoader(url.Scheme, l.loaders, Loaders)
+	if err != nil {
+		return nil, err
+	}
+
+	return ldr.Load(ctx, url)
+}
+
+func (l *loader) loadURLsRecursive(ctx gocontext.Context, parentUrls []*pkgurl.URL, urls ...*pkgurl.URL) (filedatas, error) {
+	incs := make([]includeURL, len(urls))
+	for i, url := range urls {
+		incs[i] = includeURL{url: url}
+	}
+
+	return l.loadIncludesRecursive(ctx, parentUrls, incs...)
+}
+
+func (l *loader) loadIncludesRecursive(ctx gocontext.Context, parentUrls []*pkgurl.URL, incs ...includeURL) (filedatas, error) {
+	urls := make([]*pkgurl.URL, len(incs))
+	for i, inc := range incs {
+		urls[i] = inc.url
+	}
+
+	// the fetching of the siblings is abandoned once one that is not optional fails, as the load will fail
+	fetchCtx, cancel := gocontext.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		abort sync.Once
+		cause = -1
+	)
+
+	data, errs := l.fetchURLs(fetchCtx, func(i int) {
+		if !incs[i].optional {
+			abort.Do(func() {
+				cause = i
+				cancel()
+			})
+		}
+	}, urls...)
+
 	var allData filedatas
 
-	for _, url := range urls {
-		data, err := l.loadURLRecursive(parentUrls, url)
+	// the siblings are fetched concurrently, but processed in the declared order to keep the results deterministic
+	for i, url := range urls {
+		if errs[i] != nil {
+			// the failure that abandoned the fetching is reported, rather than a sibling that was abandoned
+			if incs[i].isSkippable(ctx) || (cause >= 0 && i != cause && errors.Is(errs[i], gocontext.Canceled)) {
+				continue
+			}
+
+			return nil, errs[i]
+		}
+
+		childData, err := l.loadURLDataRecursive(ctx, parentUrls, url, data[i], l.patchKind(incs[i]))
 		if err != nil {
 			return nil, err
 		}
 
-		allData = append(allData, data...)
+		for j := range childData {
+			childData[j].mount(incs[i].at)
+		}
+
+		allData = append(allData, childData...)
 	}
 
 	return allData, nil
 }
 
-func (l *loader) loadURLRecursive(parentUrls []*pkgurl.URL, url *pkgurl.URL) (filedatas, error) {
-	data, err := loadURL(url)
+// fetchURLs fetches the urls concurrently, calling failed, if it is not nil, with the index of each url that fails.
+func (l *loader) fetchURLs(ctx gocontext.Context, failed func(i int), urls ...*pkgurl.URL) ([][]byte, []error) {
+	data := make([][]byte, len(urls))
+	errs := make([]error, len(urls))
+
+	workers := min(max(l.concurrency, 1), len(urls))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				data[i], errs[i] = l.fetchURL(ctx, urls[i])
+				if errs[i] != nil && failed != nil {
+					failed(i)
+				}
+			}
+		}()
+	}
+
+	for i := range urls {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return data, errs
+}
+
+func (l *loader) fetchURL(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	err := ctx.Err()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w : %v : %w", errFailedToLoad, url.String(), err)
 	}
 
-	fdata, err := l.newFiledata(data, url)
+	return l.loadURL(ctx, url)
+}
+
+func (l *loader) loadURLDataRecursive(ctx gocontext.Context, parentUrls []*pkgurl.URL, url *pkgurl.URL, data []byte,
+	patch patchKind,
+) (filedatas, error) {
+	fdata, err := l.newFiledatas(data, url, patch)
 	if err != nil {
 		return nil, err
 	}
 
-	return l.loadDatumRecursive(parentUrls, url, &fdata)
+	var allData filedatas
+
+	for i := range fdata {
+		childData, err := l.loadDatumRecursive(ctx, parentUrls, url, &fdata[i])
+		if err != nil {
+			return nil, err
+		}
+
+		allData = append(allData, childData...)
+	}
+
+	return allData, nil
 }
 
-func (l *loader) loadDataRecursive(parentUrls []*pkgurl.URL, data ...filedata) (filedatas, error) {
+func (l *loader) loadDataRecursive(ctx gocontext.Context, parentUrls []*pkgurl.URL, data ...filedata) (filedatas, error) {
 	var allData filedatas
 
 	for _, datum := range data {
-		childData, err := l.loadDatumRecursive(parentUrls, nil, &datum)
+		childData, err := l.loadDatumRecursive(ctx, parentUrls, nil, &datum)
 		if err != nil {
 			return nil, err
 		}
@@ -79,7 +258,7 @@ func (l *loader) loadDataRecursive(parentUrls []*pkgurl.URL, data ...filedata) (
 	return allData, nil
 }
 
-func (l *loader) loadDatumRecursive(parentUrls []*pkgurl.URL, url *pkgurl.URL, data *filedata) (filedatas, error) {
+func (l *loader) loadDatumRecursive(ctx gocontext.Context, parentUrls []*pkgurl.URL, url *pkgurl.URL, data *filedata) (filedatas, error) {
 	if data.isEmpty() {
 		return nil, nil
 	}
@@ -88,7 +267,7 @@ func (l *loader) loadDatumRecursive(parentUrls []*pkgurl.URL, url *pkgurl.URL, d
 		return nil, fmt.Errorf("%w (%v)", errRecursiveURL, url)
 	}
 
-	childUrls, err := toURLs(url, data.includes...)
+	childIncs, err := resolveIncludes(url, data.includes...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,11 +280,25 @@ func (l *loader) loadDatumRecursive(parentUrls []*pkgurl.URL, url *pkgurl.URL, d
 		newParentUrls = append(newParentUrls, url)
 	}
 
-	childData, err := l.loadURLsRecursive(newParentUrls, childUrls...)
+	childIncs, err = l.expandGlobs(ctx, newParentUrls, childIncs)
 	if err != nil {
 		return nil, err
 	}
 
+	childData, err := l.loadIncludesRecursive(ctx, newParentUrls, childIncs...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range data.items {
+		item := &data.items[i]
+
+		item.fdata, err = l.loadDatumRecursive(ctx, parentUrls, url, item.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var allData filedatas
 
 	allData = append(allData, childData...)
@@ -122,33 +315,58 @@ func (l *loader) wrapFiledatas(bytes ...[]byte) (filedatas, error) {
 	var fds []filedata
 
 	for _, b := range bytes {
-		fd, err := l.wrapFiledata(b)
+		fd, err := l.newFiledatas(b, &emptyURL, "")
 		if err != nil {
 			return nil, err
 		}
 
-		fds = append(fds, fd)
+		fds = append(fds, fd...)
 	}
 
 	return fds, nil
 }
 
-func loadURL(url *pkgurl.URL) ([]byte, error) {
-	if url.Scheme == "file" {
-		// attempt to load locally handling case where we are loading from fifo etc
-		b, err := os.ReadFile(getPath(url.Path))
-		if err == nil {
-			return b, nil
-		}
+func loadURL(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	ldr, err := lookupLoader(url.Scheme, Loaders)
+	if err != nil {
+		return nil, err
 	}
 
-	if url.Scheme == "gs" {
-		return loadConfigFromBucket(url)
+	return ldr.Load(ctx, url)
+}
+
+func loadFile(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// attempt to load locally handling case where we are loading from fifo etc
+	b, err := os.ReadFile(getPath(url.Path))
+	if err == nil {
+		return b, nil
 	}
 
-	client := http.Client{Transport: newTransport()}
+	return loadHTTP(ctx, url)
+}
 
-	resp, err := client.Get(url.String()) //nolint:noctx // we don't have ctx anywhere
+func loadHTTP(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+	return loadHTTPWithClient(ctx, httpClient, url)
+}
+
+func newHTTPLoader(client *http.Client) Loader {
+	return LoaderFunc(func(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
+		return loadHTTPWithClient(ctx, client, url)
+	})
+}
+
+func loadHTTPWithClient(ctx gocontext.Context, client *http.Client, url *pkgurl.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -168,20 +386,24 @@ func loadURL(url *pkgurl.URL) ([]byte, error) {
 	return data, err
 }
 
-func loadConfigFromBucket(url *pkgurl.URL) ([]byte, error) {
+func loadConfigFromBucket(ctx gocontext.Context, url *pkgurl.URL) ([]byte, error) {
 	bucket := url.Host
 	fileName := strings.TrimLeft(url.Path, "/")
 
-	context := ctx.Background()
-
-	client, err := storage.NewClient(context)
+	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create gcp storage client: %w", err)
 	}
 
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Printf("error when closing the gcp storage client: %v", err.Error())
+		}
+	}()
+
 	bucketHandler := client.Bucket(bucket)
 
-	rc, err := bucketHandler.Object(fileName).NewReader(context)
+	rc, err := bucketHandler.Object(fileName).NewReader(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open file from bucket %q, file %q: %w", bucket, fileName, err)
 	}
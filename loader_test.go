@@ -2,8 +2,12 @@ package conflate
 
 import (
 	gocontext "context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"sync"
 	"testing"
@@ -167,7 +171,7 @@ func TestToURLs(t *testing.T) {
 // --------
 
 func TestLoadURLError(t *testing.T) {
-	data, err := loadURL(&url.URL{})
+	data, err := loadURL(gocontext.Background(), &url.URL{})
 	assert.NotNil(t, err)
 	assert.Nil(t, data)
 }
@@ -234,12 +238,47 @@ func TestLoadURL(t *testing.T) {
 	u, err := url.Parse("http://0.0.0.0:9999/valid_parent.json")
 	assert.Nil(t, err)
 
-	data, err := loadURL(u)
+	data, err := loadURL(gocontext.Background(), u)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 	assert.Contains(t, string(data), "parent")
 }
 
+func TestLoadHTTP_ReusesConnections(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns int
+	)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"x": 1}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/x.json")
+	assert.Nil(t, err)
+
+	for range 3 {
+		data, err := loadHTTP(gocontext.Background(), u)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"x": 1}`, string(data))
+	}
+
+	// the loads share the default transport, so its idle connection is reused
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, conns)
+}
+
 func TestLoadURL_Relative(t *testing.T) {
 	root, err := workingDir()
 	assert.Nil(t, err)
@@ -247,7 +286,7 @@ func TestLoadURL_Relative(t *testing.T) {
 	u, err := toURL(root, "./testdata/valid_parent.json")
 	assert.Nil(t, err)
 
-	data, err := loadURL(u)
+	data, err := loadURL(gocontext.Background(), u)
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 	assert.Contains(t, string(data), "parent")
@@ -255,10 +294,61 @@ func TestLoadURL_Relative(t *testing.T) {
 
 // --------
 
-var testLoader = loader{newFiledata: newFiledata}
+func testMemoryLoader(files map[string]string) Loader {
+	return LoaderFunc(func(_ gocontext.Context, url *url.URL) ([]byte, error) {
+		data, ok := files[url.Host+url.Path]
+		if !ok {
+			return nil, errFailedToLoad
+		}
+
+		return []byte(data), nil
+	})
+}
+
+// testMemConflate returns a Conflate instance with the options, which loads the files with the mem scheme.
+func testMemConflate(files map[string]string, opts ...Option) *Conflate {
+	return New(append(opts, WithLoader("mem", testMemoryLoader(files)))...)
+}
+
+func TestLookupLoader(t *testing.T) {
+	mem := testMemoryLoader(nil)
+	l, err := lookupLoader("MEM", LoaderMap{"mem": mem}, Loaders)
+	assert.Nil(t, err)
+	assert.NotNil(t, l)
+
+	l, err = lookupLoader("unknown", LoaderMap{"mem": mem}, Loaders)
+	assert.Nil(t, err)
+	assert.NotNil(t, l)
+}
+
+func TestLookupLoader_Error(t *testing.T) {
+	l, err := lookupLoader("unknown", LoaderMap{"mem": testMemoryLoader(nil)})
+	assert.NotNil(t, err)
+	assert.Nil(t, l)
+	assert.Contains(t, err.Error(), "no loader is registered for the url scheme")
+}
+
+func TestLoader_LoadURLInstanceLoader(t *testing.T) {
+	l := newLoader()
+	l.loaders["mem"] = testMemoryLoader(map[string]string{"host/file.json": `{"x": 1}`})
+
+	u, err := url.Parse("mem://host/file.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURL(gocontext.Background(), u)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"x": 1}`, string(data))
+
+	_, err = loadURL(gocontext.Background(), u)
+	assert.NotNil(t, err)
+}
+
+// --------
+
+var testLoader = newLoader()
 
 func TestLoadURLsRecursive_LoadError(t *testing.T) {
-	data, err := testLoader.loadURLsRecursive(nil, &url.URL{})
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, &url.URL{})
 	assert.NotNil(t, err)
 	assert.Nil(t, data)
 }
@@ -272,7 +362,7 @@ func TestLoadURLsRecursive_IncludesError(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "could not unmarshal")
 	assert.Nil(t, data)
@@ -287,7 +377,7 @@ func TestLoadURLsRecursive_BadUrlInInclude(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "could not parse path")
 	assert.Nil(t, data)
@@ -302,7 +392,7 @@ func TestLoadURLsRecursive_MissingFileInInclude(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "failed to load url")
 	assert.Nil(t, data)
@@ -317,7 +407,7 @@ func TestLoadURLsRecursive_RecursiveInclude(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "the url recursively includes itself")
 	assert.Nil(t, data)
@@ -332,7 +422,7 @@ func TestLoadURLsRecursive(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 	assert.Equal(t, 3, len(data))
@@ -350,7 +440,7 @@ func TestLoadURLsRecursive_BlankChildYaml(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
@@ -364,7 +454,7 @@ func TestLoadURLsRecursive_BlankChildJson(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
@@ -378,11 +468,253 @@ func TestLoadURLsRecursive_BlankChildToml(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, u)
 
-	data, err := testLoader.loadURLsRecursive(nil, u)
+	data, err := testLoader.loadURLsRecursive(gocontext.Background(), nil, u)
 	assert.Nil(t, err)
 	assert.NotNil(t, data)
 }
 
+func TestLoadURLsRecursive_Cancelled(t *testing.T) {
+	u, err := toURL(nil, "testdata/valid_parent.json")
+	assert.Nil(t, err)
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	data, err := testLoader.loadURLsRecursive(ctx, nil, u)
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+	assert.Nil(t, data)
+}
+
+func TestLoadURLsRecursive_CancelledInclude(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+
+	l := newLoader()
+	l.loaders["mem"] = LoaderFunc(func(_ gocontext.Context, _ *url.URL) ([]byte, error) {
+		// cancel while the parent is being loaded, so that the include is never fetched
+		cancel()
+
+		return []byte(`{"includes": ["child.json"]}`), nil
+	})
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURLsRecursive(ctx, nil, u)
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+	assert.Contains(t, err.Error(), "mem://host/child.json")
+	assert.Nil(t, data)
+}
+
+func TestLoadURL_HTTPDeadline(t *testing.T) {
+	block := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-block
+	}))
+
+	// the handler is unblocked before the server is closed, which waits for it
+	defer server.Close()
+	defer close(block)
+
+	u, err := url.Parse(server.URL + "/valid_parent.json")
+	assert.Nil(t, err)
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	data, err := loadURL(ctx, u)
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, gocontext.DeadlineExceeded)
+	assert.Nil(t, data)
+}
+
+var errTestBarrier = errors.New("timed out waiting for the loads to be in flight together")
+
+// testConcurrentLoader holds the loads of the included files until width of them are in flight together,
+// so that the number in flight is deterministic.
+type testConcurrentLoader struct {
+	files       map[string]string
+	width       int
+	mu          sync.Mutex
+	waiting     int
+	release     chan struct{}
+	inFlight    int
+	maxInFlight int
+}
+
+func newTestConcurrentLoader(files map[string]string, width int) *testConcurrentLoader {
+	return &testConcurrentLoader{files: files, width: width, release: make(chan struct{})}
+}
+
+func (l *testConcurrentLoader) Load(_ gocontext.Context, url *url.URL) ([]byte, error) {
+	l.mu.Lock()
+	l.inFlight++
+	l.maxInFlight = max(l.maxInFlight, l.inFlight)
+	release := l.release
+
+	if url.Path != "/parent.json" {
+		l.waiting++
+		if l.waiting == l.width {
+			close(l.release)
+			l.waiting = 0
+			l.release = make(chan struct{})
+		}
+	} else {
+		release = nil
+	}
+
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+	}()
+
+	if release != nil {
+		// the timeout only stops a broken test from hanging
+		select {
+		case <-release:
+		case <-time.After(10 * time.Second):
+			return nil, errTestBarrier
+		}
+	}
+
+	data, ok := l.files[url.Host+url.Path]
+	if !ok {
+		return nil, errFailedToLoad
+	}
+
+	return []byte(data), nil
+}
+
+func testConcurrentFiles() map[string]string {
+	files := map[string]string{
+		"host/parent.json": `{"includes": ["c1.json", "c2.json", "c3.json", "c4.json", "c5.json", "c6.json"]}`,
+	}
+
+	for i := 1; i <= 6; i++ {
+		files[fmt.Sprintf("host/c%v.json", i)] = fmt.Sprintf(`{"x": "c%v"}`, i)
+	}
+
+	return files
+}
+
+func TestLoadURLsRecursive_Concurrent(t *testing.T) {
+	mem := newTestConcurrentLoader(testConcurrentFiles(), 3)
+	l := newLoader()
+	l.loaders["mem"] = mem
+	l.concurrency = 3
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, mem.maxInFlight)
+	assert.Equal(t, 7, len(data))
+
+	for i := 1; i <= 6; i++ {
+		assert.Equal(t, fmt.Sprintf("mem://host/c%v.json", i), data[i-1].url.String())
+	}
+
+	assert.Equal(t, "mem://host/parent.json", data[6].url.String())
+}
+
+func TestLoadURLsRecursive_Sequential(t *testing.T) {
+	mem := newTestConcurrentLoader(testConcurrentFiles(), 1)
+	l := newLoader()
+	l.loaders["mem"] = mem
+	l.concurrency = 0
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, mem.maxInFlight)
+	assert.Equal(t, 7, len(data))
+}
+
+func TestLoadURLsRecursive_ConcurrentErrorOrder(t *testing.T) {
+	files := testConcurrentFiles()
+	delete(files, "host/c2.json")
+	files["host/c5.json"] = `{bad data`
+
+	mem := newTestConcurrentLoader(files, 6)
+	l := newLoader()
+	l.loaders["mem"] = mem
+	l.concurrency = 6
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to load url")
+	assert.Nil(t, data)
+}
+
+// testCancelLoader fails to load the files that are missing, and holds the loads of the others until ctx is done.
+type testCancelLoader struct {
+	files map[string]string
+}
+
+func (l testCancelLoader) Load(ctx gocontext.Context, url *url.URL) ([]byte, error) {
+	data, ok := l.files[url.Host+url.Path]
+	if !ok {
+		return nil, errFailedToLoad
+	}
+
+	if url.Path == "/parent.json" {
+		return []byte(data), nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Second):
+		return nil, errTestBarrier
+	}
+}
+
+func TestLoadURLsRecursive_CancelOnFailure(t *testing.T) {
+	files := testConcurrentFiles()
+	delete(files, "host/c4.json")
+
+	l := newLoader()
+	l.loaders["mem"] = testCancelLoader{files: files}
+	l.concurrency = 6
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	// the earlier siblings are abandoned, and the failure is reported rather than their cancellation
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.ErrorIs(t, err, errFailedToLoad)
+	assert.NotErrorIs(t, err, gocontext.Canceled)
+	assert.Nil(t, data)
+}
+
+func TestLoadURLsRecursive_OptionalFailureDoesNotCancel(t *testing.T) {
+	files := map[string]string{
+		"host/parent.json": `{"includes": [{"path": "missing.json", "optional": true}, "c1.json"]}`,
+		"host/c1.json":     `{"x": "c1"}`,
+	}
+
+	l := newLoader()
+	l.loaders["mem"] = newTestConcurrentLoader(files, 1)
+
+	u, err := url.Parse("mem://host/parent.json")
+	assert.Nil(t, err)
+
+	data, err := l.loadURLsRecursive(gocontext.Background(), nil, u)
+	assert.Nil(t, err)
+	assert.Len(t, data, 2)
+}
+
 func testPath(t *testing.T, urlPath, filePath string) {
 	t.Helper()
 
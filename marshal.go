@@ -46,7 +46,8 @@ func JSONUnmarshal(data []byte, out interface{}) error {
 	return nil
 }
 
-// YAMLUnmarshal unmarshals the data as YAML.
+// YAMLUnmarshal unmarshals the data as YAML. Only the first document of a stream is unmarshalled,
+// though the documents of loaded files are each merged in turn, see Conflate.SelectDocuments.
 func YAMLUnmarshal(data []byte, out interface{}) error {
 	err := yaml.Unmarshal(data, out)
 	if err != nil {
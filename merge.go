@@ -5,6 +5,18 @@ import (
 	"reflect"
 )
 
+// merger holds the state needed to merge the data from a single source.
+type merger struct {
+	source     string
+	provenance provenances
+	// positions locates the values in the source data, and merged records the origins of the values merged from it.
+	positions locator
+	merged    origins
+	rules     mergeRules
+	// warnings collects any warnings about the merge.
+	warnings *[]string
+}
+
 func mergeTo(toData interface{}, fromData ...interface{}) error {
 	for _, fromDatum := range fromData {
 		err := merge(toData, fromDatum)
@@ -17,23 +29,72 @@ func mergeTo(toData interface{}, fromData ...interface{}) error {
 }
 
 func merge(pToData, fromData interface{}) error {
-	return mergeRecursive(rootContext(), pToData, fromData)
+	return merger{}.merge(pToData, fromData)
+}
+
+func (m merger) merge(pToData, fromData interface{}) error {
+	return m.mergeRecursive(rootContext(), rootContext(), pToData, fromData)
+}
+
+// record notes that the value located by from in the source data has been merged to the location to.
+func (m merger) record(to, from context, value interface{}) {
+	m.provenance.record(to, m.source, value)
+	m.merged.copy(to, from, value, m.positions)
+}
+
+// insert returns a copy of a value that is new to the destination, without any deletion markers, and records it.
+// The destination never shares maps or slices with the source data, so later merges cannot modify the source.
+func (m merger) insert(to, from context, value interface{}) interface{} {
+	value = m.rules.stripDeletes(value)
+	m.record(to, from, value)
+
+	return value
+}
+
+// shift moves what has been recorded for the items of the array at ctx, from index start onwards, along by offset.
+func (m merger) shift(ctx context, start, offset int) {
+	m.provenance.shift(ctx, start, offset)
+	m.merged.shift(ctx, start, offset)
 }
 
-func mergeRecursive(ctx context, pToData, fromData interface{}) error {
+// delete records that the value at ctx has been deleted.
+func (m merger) delete(ctx context) {
+	m.provenance.delete(ctx, m.source)
+	m.merged.remove(ctx)
+}
+
+// deleteItem records that the item of the array at ctx has been deleted, and moves the items after it down.
+func (m merger) deleteItem(ctx context, i int) {
+	m.provenance.deleteItem(ctx.addInt(i), m.source)
+	m.merged.remove(ctx.addInt(i))
+	m.shift(ctx, i+1, -1)
+}
+
+// removeItem forgets what has been recorded for the item of the array at ctx, and moves the items after it down.
+func (m merger) removeItem(ctx context, i int) {
+	m.forget(ctx.addInt(i))
+	m.shift(ctx, i+1, -1)
+}
+
+// clear forgets what has been recorded for the descendants of ctx.
+func (m merger) clear(ctx context) {
+	m.provenance.clear(ctx)
+	m.merged.clear(ctx)
+}
+
+func (m merger) error(ctx, from context, msg string) error {
+	return &contextError{context: ctx, msg: msg, position: positionOf(m.positions, from)}
+}
+
+// mergeRecursive merges the value located by from in the source data into the value located by ctx in the destination.
+func (m merger) mergeRecursive(ctx, from context, pToData, fromData interface{}) error {
 	if pToData == nil {
-		return &contextError{
-			context: ctx,
-			msg:     "the destination variable must not be nil",
-		}
+		return m.error(ctx, from, "the destination variable must not be nil")
 	}
 
 	pToVal := reflect.ValueOf(pToData)
 	if pToVal.Kind() != reflect.Ptr {
-		return &contextError{
-			context: ctx,
-			msg:     "the destination variable must be a pointer",
-		}
+		return m.error(ctx, from, "the destination variable must be a pointer")
 	}
 
 	if fromData == nil {
@@ -46,48 +107,80 @@ func mergeRecursive(ctx context, pToData, fromData interface{}) error {
 	toData := toVal.Interface()
 
 	if toVal.Interface() == nil {
-		toVal.Set(fromVal)
+		toVal.Set(reflect.ValueOf(m.insert(ctx, from, fromData)))
 
 		return nil
 	}
 
+	if fn := m.rules.mergeFunc(ctx.pointer()); fn != nil {
+		return m.mergeFunc(ctx, from, fn, toVal, toData, fromData)
+	}
+
+	if conflicts(toData, fromData) {
+		resolved, err := m.resolveConflict(ctx, from, toVal, toData, fromData)
+		if resolved {
+			return err
+		}
+	}
+
 	var err error
 
 	//nolint:exhaustive // to be refactored
 	switch fromVal.Kind() {
 	case reflect.Map:
-		err = mergeMapRecursive(ctx, toData, fromData)
+		err = m.mergeObjectRecursive(ctx, from, toVal, toData, fromData)
 	case reflect.Slice:
-		err = mergeSliceRecursive(ctx, toVal, toData, fromData)
+		err = m.mergeSliceRecursive(ctx, from, toVal, toData, fromData)
 	default:
-		err = mergeDefaultRecursive(ctx, toVal, fromVal, toData, fromData)
+		err = m.mergeDefaultRecursive(ctx, from, toVal, fromVal, toData, fromData)
 	}
 
 	return err
 }
 
-func mergeMapRecursive(ctx context, toData, fromData interface{}) error {
+func (m merger) mergeObjectRecursive(ctx, from context, toVal reflect.Value, toData, fromData interface{}) error {
+	switch strategy := m.rules.objectMerge(ctx.pointer()); strategy {
+	case objectMerge, "":
+		return m.mergeMapRecursive(ctx, from, toData, fromData)
+	case objectReplace:
+		if _, ok := toData.(map[string]interface{}); !ok {
+			return m.error(ctx, from, "the destination value must be a map[string]interface{}")
+		}
+
+		m.clear(ctx)
+		toVal.Set(reflect.ValueOf(m.insert(ctx, from, fromData)))
+
+		return nil
+	default:
+		return m.error(ctx, from, fmt.Sprintf("unknown object merge strategy : %v", strategy))
+	}
+}
+
+func (m merger) mergeMapRecursive(ctx, from context, toData, fromData interface{}) error {
 	fromProps, ok := fromData.(map[string]interface{})
 	if !ok {
-		return &contextError{
-			context: ctx,
-			msg:     "the source value must be a map[string]interface{}",
-		}
+		return m.error(ctx, from, "the source value must be a map[string]interface{}")
 	}
 
 	toProps, ok := toData.(map[string]interface{})
 	if toProps == nil || !ok {
-		return &contextError{
-			context: ctx,
-			msg:     "the destination value must be a map[string]interface{}",
-		}
+		return m.error(ctx, from, "the destination value must be a map[string]interface{}")
 	}
 
 	for name, fromProp := range fromProps {
+		if m.rules.isDelete(fromProp) {
+			if _, ok := toProps[name]; ok {
+				delete(toProps, name)
+				m.delete(ctx.add(name))
+			}
+
+			continue
+		}
+
 		if val := toProps[name]; val == nil {
-			toProps[name] = fromProp
+			toProps[name] = m.insert(ctx.add(name), from.add(name), fromProp)
 		} else {
-			err := merge(&val, fromProp)
+			err := m.mergeRecursive(ctx.add(name), from.add(name), &val, fromProp)
 			if err != nil {
 				return &contextError{
 					context: ctx.add(name),
@@ -102,31 +195,163 @@ func mergeMapRecursive(ctx context, toData, fromData interface{}) error {
 	return nil
 }
 
-func mergeSliceRecursive(ctx context, toVal reflect.Value, toData, fromData interface{}) error {
+func (m merger) mergeSliceRecursive(ctx, from context, toVal reflect.Value, toData, fromData interface{}) error {
 	fromItems, ok := fromData.([]interface{})
 	if !ok {
-		return &contextError{
-			context: ctx,
-			msg:     "the source value must be a []interface{}",
-		}
+		return m.error(ctx, from, "the source value must be a []interface{}")
 	}
 
 	toItems, ok := toData.([]interface{})
 	if toItems == nil || !ok {
-		return &contextError{
-			context: ctx,
-			msg:     "the destination value must be a []interface{}",
-		}
+		return m.error(ctx, from, "the destination value must be a []interface{}")
+	}
+
+	var (
+		items []interface{}
+		err   error
+	)
+
+	am := m.rules.arrayMerge(ctx.pointer())
+	if am.Strategy == ArrayKeyed && am.Key == "" {
+		return m.error(ctx, from, "the keyed array merge strategy requires a key")
+	}
+
+	toItems, fromItems, froms := m.deleteItems(ctx, from, am, toItems, fromItems)
+
+	switch am.Strategy {
+	case ArrayAppend, "":
+		items = m.appendItems(ctx, froms, toItems, fromItems)
+	case ArrayPrepend:
+		items = m.prependItems(ctx, froms, toItems, fromItems)
+	case ArrayReplace:
+		items = m.replaceItems(ctx, froms, fromItems)
+	case ArrayUnion:
+		items = m.unionItems(ctx, froms, toItems, fromItems)
+	case ArrayKeyed:
+		items, err = m.keyedItems(ctx, froms, am.Key, toItems, fromItems)
+	default:
+		return m.error(ctx, from, fmt.Sprintf("unknown array merge strategy : %v", am.Strategy))
+	}
+
+	if err != nil {
+		return err
 	}
 
-	toItems = append(toItems, fromItems...)
-	toVal.Set(reflect.ValueOf(toItems))
+	toVal.Set(reflect.ValueOf(items))
 
 	return nil
 }
 
-func mergeDefaultRecursive(ctx context, toVal, fromVal reflect.Value, toData, fromData interface{}) error {
+// deleteItems removes the items deleted by any markers in fromItems from toItems.
+// It returns the remaining items, along with the rest of fromItems and their contexts in the source data.
+func (m merger) deleteItems(ctx, from context, am ArrayMerge, toItems, fromItems []interface{}) (
+	remaining, rest []interface{}, froms []context,
+) {
+	remaining = toItems
+
+	for i, item := range fromItems {
+		value, ok := deleteItem(item)
+		if !ok {
+			rest = append(rest, item)
+			froms = append(froms, from.addInt(i))
+
+			continue
+		}
+
+		kept := remaining[:0:0]
+
+		for j, toItem := range remaining {
+			if matchesDelete(toItem, value, am) {
+				m.deleteItem(ctx, len(kept))
+
+				continue
+			}
+
+			kept = append(kept, remaining[j])
+		}
+
+		remaining = kept
+	}
+
+	return remaining, rest, froms
+}
+
+func (m merger) appendItems(ctx context, froms []context, toItems, fromItems []interface{}) []interface{} {
+	items := toItems
+
+	for i, item := range fromItems {
+		items = append(items, m.insert(ctx.addInt(len(items)), froms[i], item))
+	}
+
+	return items
+}
+
+func (m merger) prependItems(ctx context, froms []context, toItems, fromItems []interface{}) []interface{} {
+	m.shift(ctx, 0, len(fromItems))
+
+	items := make([]interface{}, 0, len(fromItems)+len(toItems))
+
+	for i, item := range fromItems {
+		items = append(items, m.insert(ctx.addInt(i), froms[i], item))
+	}
+
+	return append(items, toItems...)
+}
+
+func (m merger) replaceItems(ctx context, froms []context, fromItems []interface{}) []interface{} {
+	m.clear(ctx)
+
+	items := make([]interface{}, 0, len(fromItems))
+
+	for i, item := range fromItems {
+		items = append(items, m.insert(ctx.addInt(i), froms[i], item))
+	}
+
+	return items
+}
+
+func (m merger) unionItems(ctx context, froms []context, toItems, fromItems []interface{}) []interface{} {
+	items := toItems
+
+	for i, item := range fromItems {
+		if containsItem(items, item) {
+			continue
+		}
+
+		items = append(items, m.insert(ctx.addInt(len(items)), froms[i], item))
+	}
+
+	return items
+}
+
+func (m merger) keyedItems(ctx context, froms []context, key string, toItems, fromItems []interface{}) ([]interface{}, error) {
+	items := toItems
+
+	for i, item := range fromItems {
+		j := indexOfKey(items, key, item)
+		if j < 0 {
+			items = append(items, m.insert(ctx.addInt(len(items)), froms[i], item))
+
+			continue
+		}
+
+		val := items[j]
+
+		err := m.mergeRecursive(ctx.addInt(j), froms[i], &val, item)
+		if err != nil {
+			return nil, err
+		}
+
+		items[j] = val
+	}
+
+	return items, nil
+}
+
+func (m merger) mergeDefaultRecursive(ctx, from context, toVal, fromVal reflect.Value, toData, fromData interface{}) error {
 	if reflect.DeepEqual(toData, fromData) {
+		m.record(ctx, from, fromData)
+
 		return nil
 	}
 
@@ -138,13 +363,11 @@ func mergeDefaultRecursive(ctx context, toVal, fromVal reflect.Value, toData, fr
 	}
 
 	if !fromType.AssignableTo(toType) {
-		return &contextError{
-			context: ctx,
-			msg:     fmt.Sprintf("the destination type (%v) must be the same as the source type (%v)", toType, fromType),
-		}
+		return m.error(ctx, from, fmt.Sprintf("the destination type (%v) must be the same as the source type (%v)", toType, fromType))
 	}
 
 	toVal.Set(fromVal)
+	m.record(ctx, from, fromData)
 
 	return nil
 }
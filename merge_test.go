@@ -300,6 +300,17 @@ func testMergeGetData(t *testing.T, data []byte) interface{} {
 	return out
 }
 
+// testMergeWith merges the JSON data from into to with the merger, returning the merged data.
+func testMergeWith(t *testing.T, m merger, to, from string) (interface{}, error) {
+	t.Helper()
+
+	toData := testMergeGetData(t, []byte(to))
+	fromData := testMergeGetData(t, []byte(from))
+	err := m.merge(&toData, fromData)
+
+	return toData, err
+}
+
 var testMergeData1 = []byte(`
 {
   "int_to_only": 1,
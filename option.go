@@ -0,0 +1,158 @@
+package conflate
+
+import (
+	"net/http"
+)
+
+// Option defines the type of function used to configure a Conflate instance.
+type Option func(*Conflate)
+
+// WithIncludesKey sets the top level key that holds the includes array, instead of the package level Includes.
+// A blank key suppresses the expansion of includes arrays.
+func WithIncludesKey(key string) Option {
+	return func(c *Conflate) {
+		c.loader.includes = key
+	}
+}
+
+// WithUnmarshallers sets the unmarshalling functions to be used for given file extensions, instead of the package level Unmarshallers.
+// The map is copied, and its functions are used as they are, so the LenientJSON, INITypes, DotenvTypes and
+// PropertiesTypes options have no effect, whatever the order in which the options are given.
+func WithUnmarshallers(unmarshallers UnmarshallerMap) Option {
+	return func(c *Conflate) {
+		c.loader.unmarshallers = UnmarshallerMap{}
+		for ext, funcs := range unmarshallers {
+			c.loader.unmarshallers[ext] = funcs
+		}
+
+		c.loader.customUnmarshallers = true
+	}
+}
+
+// WithExpand is an option to automatically expand environment variables in data files.
+func WithExpand(expand bool) Option {
+	return func(c *Conflate) {
+		c.Expand(expand)
+	}
+}
+
+// WithNestedIncludes is an option to honour "$include" keys and nested includes arrays, see Conflate.NestedIncludes.
+func WithNestedIncludes(nested bool) Option {
+	return func(c *Conflate) {
+		c.NestedIncludes(nested)
+	}
+}
+
+// WithDocumentSelector chooses which documents of YAML streams are merged, see Conflate.SelectDocuments.
+func WithDocumentSelector(sel DocumentSelector) Option {
+	return func(c *Conflate) {
+		c.SelectDocuments(sel)
+	}
+}
+
+// WithPatchSuffixes is an option to apply files named like prod.merge-patch.yaml as patches, see Conflate.PatchSuffixes.
+func WithPatchSuffixes(suffixes bool) Option {
+	return func(c *Conflate) {
+		c.PatchSuffixes(suffixes)
+	}
+}
+
+// WithINITypes is an option to unmarshal numbers and booleans in .ini files, see Conflate.INITypes.
+func WithINITypes(typed bool) Option {
+	return func(c *Conflate) {
+		c.INITypes(typed)
+	}
+}
+
+// WithDotenvTypes is an option to unmarshal numbers and booleans in .env files, see Conflate.DotenvTypes.
+func WithDotenvTypes(typed bool) Option {
+	return func(c *Conflate) {
+		c.DotenvTypes(typed)
+	}
+}
+
+// WithPropertiesTypes is an option to unmarshal numbers and booleans in .properties files, see Conflate.PropertiesTypes.
+func WithPropertiesTypes(typed bool) Option {
+	return func(c *Conflate) {
+		c.PropertiesTypes(typed)
+	}
+}
+
+// WithLenientJSON is an option to unmarshal .json files with comments and trailing commas, see Conflate.LenientJSON.
+func WithLenientJSON(lenient bool) Option {
+	return func(c *Conflate) {
+		c.LenientJSON(lenient)
+	}
+}
+
+// WithProvenance is an option to record which source set each value, see Conflate.Provenance.
+func WithProvenance(track bool) Option {
+	return func(c *Conflate) {
+		c.TrackProvenance(track)
+	}
+}
+
+// WithArrayMerge sets how arrays are merged into the arrays they override, see Conflate.ArrayMerge.
+func WithArrayMerge(m ArrayMerge) Option {
+	return func(c *Conflate) {
+		c.ArrayMerge(m)
+	}
+}
+
+// WithPathArrayMerge sets how the arrays located by path are merged, see Conflate.PathArrayMerge.
+func WithPathArrayMerge(path string, m ArrayMerge) Option {
+	return func(c *Conflate) {
+		c.PathArrayMerge(path, m)
+	}
+}
+
+// WithMergeSchema sets a schema whose merge keywords configure how the data is merged, see Conflate.MergeSchema.
+func WithMergeSchema(s *Schema) Option {
+	return func(c *Conflate) {
+		c.MergeSchema(s)
+	}
+}
+
+// WithNullDeletes is an option to delete an object property when it is overridden with null, see Conflate.NullDeletes.
+func WithNullDeletes(deletes bool) Option {
+	return func(c *Conflate) {
+		c.NullDeletes(deletes)
+	}
+}
+
+// WithTypeConflict sets the policy for merging values of different types, see Conflate.TypeConflict.
+func WithTypeConflict(policy TypeConflict) Option {
+	return func(c *Conflate) {
+		c.TypeConflict(policy)
+	}
+}
+
+// WithMergeFunc registers a function that merges the values located by path, see Conflate.MergeFunc.
+func WithMergeFunc(path string, fn MergeFunc) Option {
+	return func(c *Conflate) {
+		c.MergeFunc(path, fn)
+	}
+}
+
+// WithConcurrency sets the maximum number of sibling includes that are fetched in parallel.
+func WithConcurrency(n int) Option {
+	return func(c *Conflate) {
+		c.Concurrency(n)
+	}
+}
+
+// WithLoader sets the loader used for the given url scheme.
+func WithLoader(scheme string, l Loader) Option {
+	return func(c *Conflate) {
+		c.RegisterLoader(scheme, l)
+	}
+}
+
+// WithHTTPClient sets the client used to load http and https urls.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Conflate) {
+		l := newHTTPLoader(client)
+		c.RegisterLoader("http", l)
+		c.RegisterLoader("https", l)
+	}
+}
@@ -0,0 +1,153 @@
+package conflate
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_Defaults(t *testing.T) {
+	c := New()
+	assert.Equal(t, Includes, c.loader.includes)
+	assert.Equal(t, len(Unmarshallers), len(c.loader.unmarshallers))
+	assert.False(t, c.loader.expand)
+	assert.Equal(t, defaultConcurrency, c.loader.concurrency)
+}
+
+func TestNew_DefaultsAreCopied(t *testing.T) {
+	c := New()
+
+	Unmarshallers[".test"] = UnmarshallerFuncs{JSONUnmarshal}
+
+	defer delete(Unmarshallers, ".test")
+
+	_, ok := c.loader.unmarshallers[".test"]
+	assert.False(t, ok)
+}
+
+func TestWithIncludesKey(t *testing.T) {
+	c := New(WithIncludesKey("use"))
+
+	err := c.AddData([]byte(`{"use": ["testdata/valid_child.json"], "includes": ["other"]}`))
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, "child", out["child_only"])
+	assert.Equal(t, []interface{}{"other"}, out["includes"])
+	assert.Equal(t, "includes", Includes)
+}
+
+func TestWithIncludesKey_Blank(t *testing.T) {
+	c := New(WithIncludesKey(""))
+
+	err := c.AddData([]byte(`{"includes": ["missing"]}`))
+	assert.Nil(t, err)
+}
+
+func TestWithUnmarshallers(t *testing.T) {
+	var called bool
+
+	custom := func(data []byte, out interface{}) error {
+		called = true
+
+		return JSONUnmarshal(data, out)
+	}
+
+	c := New(WithUnmarshallers(UnmarshallerMap{"": {custom}}))
+
+	err := c.AddFiles("testdata/valid_child.json")
+	assert.Nil(t, err)
+	assert.True(t, called)
+}
+
+func TestWithUnmarshallers_Options(t *testing.T) {
+	unmarshallers := UnmarshallerMap{".json": {JSONUnmarshal}, ".ini": {INIUnmarshal}}
+
+	// the map is neither changed nor overridden by the options, whatever their order
+	for _, opts := range [][]Option{
+		{WithUnmarshallers(unmarshallers), WithLenientJSON(true), WithINITypes(true), WithDotenvTypes(true)},
+		{WithLenientJSON(true), WithINITypes(true), WithPropertiesTypes(true), WithUnmarshallers(unmarshallers)},
+	} {
+		c := testMemConflate(map[string]string{"host/a.json": "{a: 1}"}, opts...)
+		assert.Len(t, c.loader.unmarshallers, 2)
+		assert.Len(t, c.loader.unmarshallers[".json"], 1)
+
+		c.LenientJSON(true)
+		assert.Len(t, c.loader.unmarshallers[".json"], 1)
+
+		err := c.AddFiles("mem://host/a.json")
+		assert.NotNil(t, err)
+	}
+
+	assert.Len(t, unmarshallers, 2)
+	assert.Len(t, unmarshallers[".json"], 1)
+
+	c := New(WithUnmarshallers(unmarshallers))
+	unmarshallers[".yaml"] = UnmarshallerFuncs{YAMLUnmarshal}
+	assert.NotContains(t, c.loader.unmarshallers, ".yaml")
+}
+
+func TestWithExpand(t *testing.T) {
+	t.Setenv("X", "123")
+
+	c := New(WithExpand(true))
+
+	err := c.AddData([]byte(`{"x": $X}`))
+	assert.Nil(t, err)
+
+	var out map[string]interface{}
+
+	err = c.Unmarshal(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, 123.0, out["x"])
+}
+
+func TestWithConcurrency(t *testing.T) {
+	c := New(WithConcurrency(3))
+	assert.Equal(t, 3, c.loader.concurrency)
+}
+
+func TestWithLoader(t *testing.T) {
+	c := testMemConflate(map[string]string{"host/x.json": `{"x": 1}`})
+
+	err := c.AddFiles("mem://host/x.json")
+	assert.Nil(t, err)
+}
+
+type testHeaderTransport struct{}
+
+func (testHeaderTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Test", "conflate")
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "conflate" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		_, err := w.Write([]byte(`{"x": 1}`))
+		assert.Nil(t, err)
+	}))
+	defer server.Close()
+
+	c := New()
+	err := c.AddFilesContext(gocontext.Background(), server.URL+"/x.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "403")
+
+	c = New(WithHTTPClient(&http.Client{Transport: testHeaderTransport{}}))
+	err = c.AddFiles(server.URL + "/x.json")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,397 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+)
+
+var (
+	errInvalidPatch    = errors.New("the json patch is not valid")
+	errPatchFailed     = errors.New("the json patch could not be applied")
+	errPatchTestFailed = errors.New("the json patch test operation failed")
+	errUnknownPatch    = errors.New("the kind of patch is not known")
+)
+
+// patchKind identifies data that patches the merged data rather than being merged into it.
+type patchKind string
+
+const (
+	// mergePatch is a JSON merge patch (RFC 7386), included with "patch": "merge",
+	// or named like prod.merge-patch.yaml if patch suffixes are honoured.
+	mergePatch patchKind = "merge-patch"
+	// jsonPatch is a JSON patch (RFC 6902), included with "patch": "json",
+	// or named like prod.json-patch.json if patch suffixes are honoured.
+	jsonPatch patchKind = "json-patch"
+)
+
+// parsePatchKind returns the kind of patch named by the patch field of an include, which is blank if it is not a patch.
+func parsePatchKind(name string) (patchKind, error) {
+	switch name {
+	case "":
+		return "", nil
+	case "merge":
+		return mergePatch, nil
+	case "json":
+		return jsonPatch, nil
+	default:
+		return "", fmt.Errorf("%w : %q", errUnknownPatch, name)
+	}
+}
+
+// patchKindOf returns the kind of patch held by the file at the url path, or blank if it is not a patch,
+// which is only used if patch suffixes are honoured, see Conflate.PatchSuffixes.
+func patchKindOf(urlPath string) patchKind {
+	name := strings.ToLower(path.Base(urlPath))
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	for _, kind := range []patchKind{mergePatch, jsonPatch} {
+		if strings.HasSuffix(name, "."+string(kind)) {
+			return kind
+		}
+	}
+
+	return ""
+}
+
+// mergePatch applies the JSON merge patch located by from in the source data to the target located by ctx,
+// and returns the patched target.
+func (m merger) mergePatch(ctx, from context, target, patch interface{}) interface{} {
+	patchProps, ok := patch.(map[string]interface{})
+	if !ok {
+		patch = deepCopy(patch)
+		m.overwrite(ctx, from, target, patch)
+
+		return patch
+	}
+
+	targetProps, ok := target.(map[string]interface{})
+	if !ok {
+		m.forget(ctx)
+
+		targetProps = map[string]interface{}{}
+	}
+
+	for name, patchProp := range patchProps {
+		if patchProp == nil {
+			if _, ok := targetProps[name]; ok {
+				delete(targetProps, name)
+				m.delete(ctx.add(name))
+			}
+
+			continue
+		}
+
+		targetProps[name] = m.mergePatch(ctx.add(name), from.add(name), targetProps[name], patchProp)
+	}
+
+	return targetProps
+}
+
+// jsonPatch applies the operations of the JSON patch to the data pointed to by pData.
+// The data may be left partly patched if an operation fails.
+func (m merger) jsonPatch(pData *interface{}, patch interface{}) error {
+	ops, ok := patch.([]interface{})
+	if !ok {
+		return fmt.Errorf("%w : the patch must be an array of operations", errInvalidPatch)
+	}
+
+	for i, op := range ops {
+		from := rootContext().addInt(i)
+
+		err := m.jsonPatchOp(pData, from, op)
+		if err != nil {
+			return fmt.Errorf("%w : %w", errPatchFailed, err)
+		}
+	}
+
+	return nil
+}
+
+func (m merger) jsonPatchOp(pData *interface{}, from context, op interface{}) error {
+	props, ok := op.(map[string]interface{})
+	if !ok {
+		return m.error(from, from, "the operation must be an object")
+	}
+
+	name, _ := props["op"].(string)
+
+	ptr, ok := props["path"].(string)
+	if !ok {
+		return m.error(from, from, "the operation must have a string path")
+	}
+
+	tokens, err := splitPointer(ptr)
+	if err != nil {
+		return m.error(from, from, err.Error())
+	}
+
+	value, hasValue := props["value"]
+	value = deepCopy(value)
+
+	switch name {
+	case "add", "replace", "test":
+		if !hasValue {
+			return m.error(from, from, fmt.Sprintf("the %v operation must have a value", name))
+		}
+	case "move", "copy":
+		fromPtr, ok := props["from"].(string)
+		if !ok {
+			return m.error(from, from, fmt.Sprintf("the %v operation must have a string from", name))
+		}
+
+		value, err = lookupPointer(*pData, fromPtr)
+		if err != nil {
+			return m.error(from, from, err.Error())
+		}
+
+		if name == "copy" {
+			value = deepCopy(value)
+		} else {
+			if isBelow(ptr, fromPtr) {
+				return m.error(from, from, "a value cannot be moved into one of its children")
+			}
+
+			fromTokens, _ := splitPointer(fromPtr)
+
+			err = m.patchRemove(pData, from, fromTokens)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	switch name {
+	case "add", "move", "copy":
+		return m.patchAdd(pData, from, tokens, value)
+	case "remove":
+		return m.patchRemove(pData, from, tokens)
+	case "replace":
+		return m.patchReplace(pData, from, tokens, value)
+	case "test":
+		actual, err := lookupPointer(*pData, ptr)
+		if err != nil || !patchValuesEqual(actual, value) {
+			return fmt.Errorf("%w : %w", errPatchTestFailed, m.error(pointerContext(tokens), from, "the value is not as expected"))
+		}
+
+		return nil
+	default:
+		return m.error(from, from, fmt.Sprintf("unknown operation : %v", name))
+	}
+}
+
+// patchValuesEqual reports whether the values are equal for the test operation. They are compared as JSON,
+// so that numbers are equal if their values are, such as the int64 integers unmarshalled from TOML.
+func patchValuesEqual(a, b interface{}) bool {
+	var jsonA, jsonB interface{}
+
+	if jsonMarshalUnmarshal(a, &jsonA) != nil || jsonMarshalUnmarshal(b, &jsonB) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(jsonA, jsonB)
+}
+
+func (m merger) patchAdd(pData *interface{}, from context, tokens []string, value interface{}) error {
+	ctx := pointerContext(tokens)
+	valueFrom := from.add("value")
+
+	if len(tokens) == 0 {
+		m.overwrite(ctx, valueFrom, *pData, value)
+		*pData = value
+
+		return nil
+	}
+
+	parent := pointerContext(tokens[:len(tokens)-1])
+
+	return m.patchParent(pData, from, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case map[string]interface{}:
+			m.overwrite(ctx, valueFrom, v[token], value)
+			v[token] = value
+
+			return v, nil
+		case []interface{}:
+			i := len(v)
+			if token != "-" {
+				var err error
+
+				i, err = parseIndex(token)
+				if err != nil || i > len(v) {
+					return nil, m.error(ctx, from, "the array index is out of range")
+				}
+			}
+
+			m.shift(parent, i, 1)
+			m.record(parent.addInt(i), valueFrom, value)
+
+			items := make([]interface{}, 0, len(v)+1)
+			items = append(items, v[:i]...)
+			items = append(items, value)
+
+			return append(items, v[i:]...), nil
+		default:
+			return nil, m.error(ctx, from, "the parent of the path is not an object or array")
+		}
+	})
+}
+
+func (m merger) patchRemove(pData *interface{}, from context, tokens []string) error {
+	ctx := pointerContext(tokens)
+
+	if len(tokens) == 0 {
+		return m.error(ctx, from, "the root cannot be removed")
+	}
+
+	parent := pointerContext(tokens[:len(tokens)-1])
+
+	return m.patchParent(pData, from, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case map[string]interface{}:
+			if _, ok := v[token]; !ok {
+				return nil, m.error(ctx, from, "the path does not exist")
+			}
+
+			delete(v, token)
+			m.delete(ctx)
+
+			return v, nil
+		case []interface{}:
+			i, err := parseIndex(token)
+			if err != nil || i >= len(v) {
+				return nil, m.error(ctx, from, "the array index is out of range")
+			}
+
+			m.removeItem(parent, i)
+
+			items := make([]interface{}, 0, len(v)-1)
+			items = append(items, v[:i]...)
+
+			return append(items, v[i+1:]...), nil
+		default:
+			return nil, m.error(ctx, from, "the parent of the path is not an object or array")
+		}
+	})
+}
+
+func (m merger) patchReplace(pData *interface{}, from context, tokens []string, value interface{}) error {
+	_, err := lookupPointer(*pData, pointerContext(tokens).pointer())
+	if err != nil {
+		return m.error(pointerContext(tokens), from, "the path does not exist")
+	}
+
+	if len(tokens) == 0 {
+		return m.patchAdd(pData, from, tokens, value)
+	}
+
+	ctx := pointerContext(tokens)
+
+	return m.patchParent(pData, from, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case map[string]interface{}:
+			m.overwrite(ctx, from.add("value"), v[token], value)
+			v[token] = value
+
+			return v, nil
+		case []interface{}:
+			i, _ := parseIndex(token)
+			m.overwrite(ctx, from.add("value"), v[i], value)
+			v[i] = value
+
+			return v, nil
+		default:
+			return nil, m.error(ctx, from, "the parent of the path is not an object or array")
+		}
+	})
+}
+
+// patchParent calls fn with the container of the value located by the tokens, and the last of the tokens,
+// replacing the container with the one fn returns.
+func (m merger) patchParent(pData *interface{}, from context, tokens []string,
+	fn func(container interface{}, token string) (interface{}, error),
+) error {
+	updated, err := m.patchParentRecursive(*pData, from, rootContext(), tokens, fn)
+	if err != nil {
+		return err
+	}
+
+	*pData = updated
+
+	return nil
+}
+
+func (m merger) patchParentRecursive(data interface{}, from, ctx context, tokens []string,
+	fn func(container interface{}, token string) (interface{}, error),
+) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(data, tokens[0])
+	}
+
+	ctx = ctx.add(tokens[0])
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		child, ok := v[tokens[0]]
+		if !ok {
+			return nil, m.error(ctx, from, "the path does not exist")
+		}
+
+		updated, err := m.patchParentRecursive(child, from, ctx, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		v[tokens[0]] = updated
+
+		return v, nil
+	case []interface{}:
+		i, err := parseIndex(tokens[0])
+		if err != nil || i >= len(v) {
+			return nil, m.error(ctx, from, "the path does not exist")
+		}
+
+		updated, err := m.patchParentRecursive(v[i], from, ctx, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		v[i] = updated
+
+		return v, nil
+	default:
+		return nil, m.error(ctx, from, "the path does not exist")
+	}
+}
+
+// overwrite records that the value replaces the old value at ctx.
+// The history of a scalar replaced by a scalar is kept, otherwise what was recorded for the old value is forgotten.
+func (m merger) overwrite(ctx, from context, old, value interface{}) {
+	if isContainer(old) || isContainer(value) {
+		m.forget(ctx)
+	}
+
+	m.record(ctx, from, value)
+}
+
+// forget forgets what has been recorded for the value at ctx and its descendants.
+func (m merger) forget(ctx context) {
+	m.provenance.remove(ctx)
+	m.merged.remove(ctx)
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// pointerContext returns the context of the value located by the JSON pointer tokens.
+func pointerContext(tokens []string) context {
+	return rootContext().add(tokens...)
+}
@@ -0,0 +1,281 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchKindOf(t *testing.T) {
+	assert.Equal(t, mergePatch, patchKindOf("/conf/prod.merge-patch.yaml"))
+	assert.Equal(t, mergePatch, patchKindOf("/conf/PROD.Merge-Patch.JSON"))
+	assert.Equal(t, jsonPatch, patchKindOf("prod.json-patch.json"))
+	assert.Equal(t, patchKind(""), patchKindOf("/conf/prod.json"))
+	assert.Equal(t, patchKind(""), patchKindOf("/conf/json-patch.json"))
+	assert.Equal(t, patchKind(""), patchKindOf(""))
+}
+
+func TestMergePatch(t *testing.T) {
+	// the examples from RFC 7386 appendix A
+	tests := []struct{ target, patch, result string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		var target, patch, expected interface{}
+
+		assert.Nil(t, JSONUnmarshal([]byte(test.target), &target))
+		assert.Nil(t, JSONUnmarshal([]byte(test.patch), &patch))
+		assert.Nil(t, JSONUnmarshal([]byte(test.result), &expected))
+
+		result := merger{}.mergePatch(rootContext(), rootContext(), target, patch)
+		assert.Equal(t, expected, result, test.patch)
+	}
+}
+
+func testJSONPatch(t *testing.T, doc, patch string) (interface{}, error) {
+	t.Helper()
+
+	data := testMergeGetData(t, []byte(doc))
+	err := merger{}.jsonPatch(&data, testMergeGetData(t, []byte(patch)))
+
+	return data, err
+}
+
+func TestJSONPatch(t *testing.T) {
+	data, err := testJSONPatch(t,
+		`{"a": {"b": 1}, "c": [1, 2], "d": "x"}`,
+		`[
+			{"op": "add", "path": "/a/e", "value": {"f": 1}},
+			{"op": "add", "path": "/c/1", "value": 3},
+			{"op": "add", "path": "/c/-", "value": 4},
+			{"op": "remove", "path": "/c/0"},
+			{"op": "replace", "path": "/d", "value": "y"},
+			{"op": "move", "from": "/a/b", "path": "/b"},
+			{"op": "copy", "from": "/a/e", "path": "/e"},
+			{"op": "test", "path": "/e/f", "value": 1},
+			{"op": "add", "path": "/a~1b", "value": true}
+		]`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"a": {"e": {"f": 1}}, "b": 1, "c": [3, 2, 4], "d": "y",
+		"e": {"f": 1}, "a/b": true}`)), data)
+}
+
+func TestJSONPatch_Root(t *testing.T) {
+	data, err := testJSONPatch(t, `{"a": 1}`, `[{"op": "replace", "path": "", "value": {"b": 2}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"b": 2}`)), data)
+
+	_, err = testJSONPatch(t, `{"a": 1}`, `[{"op": "remove", "path": ""}]`)
+	assert.ErrorIs(t, err, errPatchFailed)
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	tests := []struct{ patch, msg string }{
+		{`{"op": "add"}`, "must be an array of operations"},
+		{`["x"]`, "must be an object"},
+		{`[{"op": "add", "value": 1}]`, "must have a string path"},
+		{`[{"op": "add", "path": "a", "value": 1}]`, "must be blank or start with '/'"},
+		{`[{"op": "add", "path": "/a"}]`, "must have a value"},
+		{`[{"op": "move", "path": "/a"}]`, "must have a string from"},
+		{`[{"op": "copy", "from": "/x", "path": "/a"}]`, "no value exists"},
+		{`[{"op": "move", "from": "/o", "path": "/o/x"}]`, "cannot be moved into one of its children"},
+		{`[{"op": "remove", "path": "/x"}]`, "the path does not exist (#/x)"},
+		{`[{"op": "remove", "path": "/x/y"}]`, "the path does not exist (#/x)"},
+		{`[{"op": "remove", "path": "/a/5"}]`, "out of range (#/a/5)"},
+		{`[{"op": "add", "path": "/a/5", "value": 1}]`, "out of range (#/a/5)"},
+		{`[{"op": "add", "path": "/a/01", "value": 1}]`, "out of range (#/a/01)"},
+		{`[{"op": "add", "path": "/a/+0", "value": 1}]`, "out of range (#/a/+0)"},
+		{`[{"op": "remove", "path": "/a/00"}]`, "out of range (#/a/00)"},
+		{`[{"op": "replace", "path": "/a/+0", "value": 1}]`, "the path does not exist (#/a/+0)"},
+		{`[{"op": "add", "path": "/s/x", "value": 1}]`, "not an object or array (#/s/x)"},
+		{`[{"op": "replace", "path": "/x", "value": 1}]`, "the path does not exist (#/x)"},
+		{`[{"op": "test", "path": "/s", "value": "t"}]`, "not as expected (#/s)"},
+		{`[{"op": "other", "path": "/s"}]`, "unknown operation : other"},
+	}
+
+	for _, test := range tests {
+		_, err := testJSONPatch(t, `{"a": [1], "o": {}, "s": "s"}`, test.patch)
+		assert.NotNil(t, err, test.patch)
+
+		if err != nil {
+			assert.Contains(t, err.Error(), test.msg, test.patch)
+		}
+	}
+}
+
+func TestConflate_ApplyMergePatch(t *testing.T) {
+	c := New(WithProvenance(true), WithExpand(true))
+	err := c.AddData([]byte(`{"db": {"host": "a", "port": 1}, "tags": ["x"]}`))
+	assert.Nil(t, err)
+
+	t.Setenv("CONFLATE_TEST_HOST", "b")
+
+	err = c.ApplyMergePatch([]byte(`{"db": {"host": "$CONFLATE_TEST_HOST", "port": null}, "tags": ["y"]}`))
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"db": {"host": "b"}, "tags": ["y"]}`)), data)
+	assert.Equal(t, `/db/host: <data> (overrides <data>)
+/db/port: deleted by <data> (overrides <data>)
+/tags/0: <data>
+`, c.Explain())
+}
+
+func TestConflate_ApplyJSONPatch(t *testing.T) {
+	c := New(WithProvenance(true))
+	err := c.AddData([]byte(`{"db": {"host": "a"}, "tags": ["x", "y"]}`))
+	assert.Nil(t, err)
+
+	err = c.ApplyJSONPatch([]byte(`[{"op": "remove", "path": "/tags/0"}, {"op": "replace", "path": "/db/host", "value": "b"}]`))
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"db": {"host": "b"}, "tags": ["y"]}`)), data)
+	assert.Equal(t, `/db/host: <data> (overrides <data>)
+/tags/0: <data>
+`, c.Explain())
+}
+
+func TestConflate_ApplyJSONPatchAtomic(t *testing.T) {
+	c := New(WithProvenance(true))
+	err := c.AddData([]byte(`{"db": {"host": "a"}}`))
+	assert.Nil(t, err)
+
+	err = c.ApplyJSONPatch([]byte(`[{"op": "replace", "path": "/db/host", "value": "b"}, {"op": "remove", "path": "/x"}]`))
+	assert.ErrorIs(t, err, errPatchFailed)
+
+	val, err := c.Lookup("/db/host")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+	assert.Equal(t, "/db/host: <data>\n", c.Explain())
+}
+
+func TestConflate_ApplyJSONPatchTestTOML(t *testing.T) {
+	c := testMemConflate(map[string]string{"host/base.toml": "port = 1\nratio = 0.5\n"})
+	err := c.AddFiles("mem://host/base.toml")
+	assert.Nil(t, err)
+
+	err = c.ApplyJSONPatch([]byte(`[{"op": "test", "path": "/port", "value": 1}, {"op": "test", "path": "/ratio", "value": 0.5}]`))
+	assert.Nil(t, err)
+
+	err = c.ApplyJSONPatch([]byte(`[{"op": "test", "path": "/port", "value": 2}]`))
+	assert.ErrorIs(t, err, errPatchTestFailed)
+}
+
+func TestConflate_ApplyJSONPatchInvalid(t *testing.T) {
+	c := New()
+	err := c.ApplyJSONPatch([]byte(`not a patch [`))
+	assert.NotNil(t, err)
+}
+
+func TestParsePatchKind(t *testing.T) {
+	kind, err := parsePatchKind("merge")
+	assert.Nil(t, err)
+	assert.Equal(t, mergePatch, kind)
+
+	kind, err = parsePatchKind("json")
+	assert.Nil(t, err)
+	assert.Equal(t, jsonPatch, kind)
+
+	kind, err = parsePatchKind("")
+	assert.Nil(t, err)
+	assert.Equal(t, patchKind(""), kind)
+
+	_, err = parsePatchKind("merge-patch")
+	assert.ErrorIs(t, err, errUnknownPatch)
+}
+
+func TestConflate_IncludePatches(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.yaml": "includes:\n  - defaults.yaml\n  - path: prod.yaml\n    patch: merge\n" +
+			"  - path: prod-ops.yaml\n    patch: json\ndb:\n  name: app\n",
+		"host/defaults.yaml": "db:\n  host: localhost\n  port: 5432\n  tls: true\n",
+		"host/prod.yaml":     "db:\n  host: db.internal\n  tls: null\n",
+		"host/prod-ops.yaml": "- op: replace\n  path: /db/port\n  value: 6432\n",
+	}, WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.yaml")
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"db": {"host": "db.internal", "port": 6432, "name": "app"}}`)), data)
+	assert.Equal(t, "mem://host/prod-ops.yaml", c.Provenance("/db/port").Source)
+	assert.True(t, c.Provenance("/db/tls").Deleted)
+}
+
+func TestConflate_IncludeUnknownPatch(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.yaml": "includes:\n  - path: prod.yaml\n    patch: strategic\n",
+		"host/prod.yaml": "a: 1\n",
+	})
+
+	err := c.AddFiles("mem://host/base.yaml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "patch")
+}
+
+func TestConflate_PatchSuffixes(t *testing.T) {
+	files := map[string]string{
+		"host/base.yaml":             "includes:\n  - prod.merge-patch.yaml\n  - prod.json-patch.yaml\ndb:\n  name: app\n",
+		"host/prod.merge-patch.yaml": "db:\n  host: db.internal\n  name: null\n",
+		"host/prod.json-patch.yaml":  "- op: add\n  path: /db/port\n  value: 6432\n",
+	}
+
+	// the names are not honoured by default, so a file named like a json patch is data that is not an object
+	c := testMemConflate(files)
+	err := c.AddFiles("mem://host/base.yaml")
+	assert.NotNil(t, err)
+
+	delete(files, "host/prod.json-patch.yaml")
+	files["host/base.yaml"] = "includes:\n  - defaults.yaml\n  - prod.merge-patch.yaml\n"
+	files["host/defaults.yaml"] = "db:\n  name: app\n"
+
+	c = testMemConflate(files)
+	err = c.AddFiles("mem://host/base.yaml")
+	assert.Nil(t, err)
+
+	_, err = c.Lookup("/db/name")
+	assert.Nil(t, err)
+
+	c = testMemConflate(files, WithPatchSuffixes(true))
+	err = c.AddFiles("mem://host/base.yaml")
+	assert.Nil(t, err)
+
+	var data interface{}
+	err = c.Unmarshal(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, testMergeGetData(t, []byte(`{"db": {"host": "db.internal"}}`)), data)
+}
+
+func TestConflate_IncludeJSONPatchErrorPosition(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/base.yaml":            "includes:\n  - prod.json-patch.yaml\n",
+		"host/prod.json-patch.yaml": "- op: remove\n  path: /db/port\n",
+	}, WithPatchSuffixes(true))
+
+	err := c.AddFiles("mem://host/base.yaml")
+	assert.ErrorIs(t, err, errPatchFailed)
+	assert.Contains(t, err.Error(), "error processing mem://host/prod.json-patch.yaml")
+	assert.Contains(t, err.Error(), "at mem://host/prod.json-patch.yaml:1:3)")
+}
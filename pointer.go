@@ -0,0 +1,139 @@
+package conflate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidPointer  = errors.New("the json pointer must be blank or start with '/'")
+	errPointerNotFound = errors.New("no value exists at the json pointer")
+	errInvalidIndex    = errors.New("the array index is not valid")
+)
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// splitPointer splits a JSON pointer (RFC 6901) into its unescaped reference tokens.
+func splitPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("%w : %v", errInvalidPointer, ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// parseIndex parses a reference token of a JSON pointer as an array index, which RFC 6901 restricts to decimal digits
+// without a sign or leading zeros.
+func parseIndex(token string) (int, error) {
+	if token == "" || (token[0] == '0' && len(token) > 1) || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w : %v", errInvalidIndex, token)
+	}
+
+	return strconv.Atoi(token)
+}
+
+// lookupPointer returns the value located by the JSON pointer within the data.
+func lookupPointer(data interface{}, ptr string) (interface{}, error) {
+	tokens, err := splitPointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			val, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%w : %v", errPointerNotFound, ptr)
+			}
+
+			data = val
+		case []interface{}:
+			i, err := parseIndex(token)
+			if err != nil || i >= len(v) {
+				return nil, fmt.Errorf("%w : %v", errPointerNotFound, ptr)
+			}
+
+			data = v[i]
+		default:
+			return nil, fmt.Errorf("%w : %v", errPointerNotFound, ptr)
+		}
+	}
+
+	return data, nil
+}
+
+// setPointer replaces the value located by the JSON pointer within the data, which must already exist.
+func setPointer(data interface{}, ptr string, value interface{}) error {
+	tokens, err := splitPointer(ptr)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w : %v", errPointerNotFound, ptr)
+	}
+
+	last := len(tokens) - 1
+
+	parent, err := lookupPointer(data, ptr[:len(ptr)-len(tokens[last])-1])
+	if err != nil {
+		return err
+	}
+
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := v[tokens[last]]; ok {
+			v[tokens[last]] = value
+
+			return nil
+		}
+	case []interface{}:
+		i, err := parseIndex(tokens[last])
+		if err == nil && i < len(v) {
+			v[i] = value
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w : %v", errPointerNotFound, ptr)
+}
+
+// isBelow reports whether the JSON pointer locates a descendant of the value located by prefix.
+func isBelow(ptr, prefix string) bool {
+	return strings.HasPrefix(ptr, prefix+"/")
+}
+
+// shiftIndex moves the array index that follows prefix in the JSON pointer along by offset, if it is at least start.
+// It reports false, and returns the pointer unchanged, if the pointer does not locate such an item of the array or one of its descendants.
+func shiftIndex(ptr, prefix string, start, offset int) (string, bool) {
+	if !isBelow(ptr, prefix) {
+		return ptr, false
+	}
+
+	rest := ptr[len(prefix)+1:]
+	token, tail := rest, ""
+
+	if i := strings.Index(rest, "/"); i >= 0 {
+		token, tail = rest[:i], rest[i:]
+	}
+
+	i, err := parseIndex(token)
+	if err != nil || i < start {
+		return ptr, false
+	}
+
+	return fmt.Sprintf("%v/%v%v", prefix, i+offset, tail), true
+}
@@ -0,0 +1,89 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPointer(t *testing.T) {
+	tokens, err := splitPointer("")
+	assert.Nil(t, err)
+	assert.Nil(t, tokens)
+
+	tokens, err = splitPointer("/a~1b/c~0d/0")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/b", "c~d", "0"}, tokens)
+
+	tokens, err = splitPointer("/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{""}, tokens)
+}
+
+func TestSplitPointer_Invalid(t *testing.T) {
+	_, err := splitPointer("a/b")
+	assert.ErrorIs(t, err, errInvalidPointer)
+}
+
+func TestLookupPointer(t *testing.T) {
+	data := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "localhost"},
+		"tags": []interface{}{"a", "b"},
+	}
+
+	val, err := lookupPointer(data, "")
+	assert.Nil(t, err)
+	assert.Equal(t, data, val)
+
+	val, err = lookupPointer(data, "/db/host")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", val)
+
+	val, err = lookupPointer(data, "/tags/1")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", val)
+}
+
+func TestLookupPointer_NotFound(t *testing.T) {
+	data := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "localhost"},
+		"tags": []interface{}{"a", "b"},
+	}
+
+	for _, ptr := range []string{"/missing", "/db/host/x", "/tags/2", "/tags/-1", "/tags/x", "/tags/01", "/tags/+1", "/tags/"} {
+		_, err := lookupPointer(data, ptr)
+		assert.ErrorIs(t, err, errPointerNotFound, ptr)
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	for token, expected := range map[string]int{"0": 0, "1": 1, "10": 10} {
+		i, err := parseIndex(token)
+		assert.Nil(t, err, token)
+		assert.Equal(t, expected, i, token)
+	}
+
+	for _, token := range []string{"", "-", "00", "01", "+1", "-1", "1e1", " 1", "x"} {
+		_, err := parseIndex(token)
+		assert.ErrorIs(t, err, errInvalidIndex, token)
+	}
+}
+
+func TestShiftIndex(t *testing.T) {
+	ptr, ok := shiftIndex("/a/1/b", "/a", 0, 2)
+	assert.True(t, ok)
+	assert.Equal(t, "/a/3/b", ptr)
+
+	ptr, ok = shiftIndex("/a/1", "/a", 1, 2)
+	assert.True(t, ok)
+	assert.Equal(t, "/a/3", ptr)
+
+	_, ok = shiftIndex("/ab/1", "/a", 0, 2)
+	assert.False(t, ok)
+
+	_, ok = shiftIndex("/a/x", "/a", 0, 2)
+	assert.False(t, ok)
+
+	_, ok = shiftIndex("/a/1", "/a", 2, -1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,415 @@
+package conflate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// position locates a value within the text of a source, for use in error messages.
+type position struct {
+	source string
+	line   int
+	column int
+}
+
+func (p position) isZero() bool {
+	return p.line == 0
+}
+
+func (p position) String() string {
+	if p.source == "" {
+		return fmt.Sprintf("%v:%v", p.line, p.column)
+	}
+
+	return fmt.Sprintf("%v:%v:%v", p.source, p.line, p.column)
+}
+
+// locator finds the position of the value located by a JSON pointer, reporting false if it has no position.
+type locator interface {
+	locate(ptr string) (position, bool)
+}
+
+// positionOf returns the position of the value located by ctx, which is zero if it has no position.
+func positionOf(l locator, ctx context) position {
+	if l == nil {
+		return position{}
+	}
+
+	pos, _ := l.locate(ctx.pointer())
+
+	return pos
+}
+
+// positions maps the JSON pointer of each value to its position.
+// A nil map records nothing, and lookups in it find nothing.
+type positions map[string]position
+
+func (p positions) locate(ptr string) (position, bool) {
+	pos, ok := p[ptr]
+
+	return pos, ok
+}
+
+// lazyPositions locates the positions of the values within some data the first time one is needed.
+// Locating them parses the data again, which is only needed to report an error.
+type lazyPositions struct {
+	once sync.Once
+	find func() positions
+	pos  positions
+}
+
+func newLazyPositions(find func() positions) *lazyPositions {
+	return &lazyPositions{find: find}
+}
+
+func (l *lazyPositions) locate(ptr string) (position, bool) {
+	l.once.Do(func() {
+		l.pos = l.find()
+		l.find = nil
+	})
+
+	return l.pos.locate(ptr)
+}
+
+// movedPositions locates the values which have been moved from under one JSON pointer to under another.
+type movedPositions struct {
+	src      locator
+	from, to string
+}
+
+func (m movedPositions) locate(ptr string) (position, bool) {
+	if m.src == nil || (ptr != m.to && !isBelow(ptr, m.to)) {
+		return position{}, false
+	}
+
+	return m.src.locate(m.from + ptr[len(m.to):])
+}
+
+// origin locates a merged value within the data it was merged from.
+type origin struct {
+	src locator
+	ptr string
+}
+
+// origins maps the JSON pointer of each merged value to its origin, so that its position is only located if needed.
+// A nil map records nothing, and lookups in it find nothing.
+type origins map[string]origin
+
+func (o origins) locate(ptr string) (position, bool) {
+	org, ok := o[ptr]
+	if !ok {
+		return position{}, false
+	}
+
+	return org.src.locate(org.ptr)
+}
+
+// copy records that the value located by from in src, and all its descendants, have been merged under the to context.
+func (o origins) copy(to, from context, value interface{}, src locator) {
+	if o == nil || src == nil {
+		return
+	}
+
+	o[to.pointer()] = origin{src: src, ptr: from.pointer()}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, val := range v {
+			o.copy(to.add(name), from.add(name), val, src)
+		}
+	case []interface{}:
+		for i, val := range v {
+			o.copy(to.addInt(i), from.addInt(i), val, src)
+		}
+	}
+}
+
+func (o origins) shift(ctx context, start, offset int) {
+	moved := origins{}
+
+	for ptr, org := range o {
+		if shifted, ok := shiftIndex(ptr, ctx.pointer(), start, offset); ok {
+			delete(o, ptr)
+			moved[shifted] = org
+		}
+	}
+
+	for ptr, org := range moved {
+		o[ptr] = org
+	}
+}
+
+func (o origins) clone() origins {
+	if o == nil {
+		return nil
+	}
+
+	cp := make(origins, len(o))
+	for ptr, org := range o {
+		cp[ptr] = org
+	}
+
+	return cp
+}
+
+// remove forgets the origin of the value at ctx and its descendants.
+func (o origins) remove(ctx context) {
+	delete(o, ctx.pointer())
+	o.clear(ctx)
+}
+
+func (o origins) clear(ctx context) {
+	for ptr := range o {
+		if isBelow(ptr, ctx.pointer()) {
+			delete(o, ptr)
+		}
+	}
+}
+
+// locatePositions finds the positions of the values within the data on a best-effort basis,
+// so that any data which cannot be located simply has no positions.
+// JSON is located as YAML, since it is a subset of it, unless it has comments or other extensions of JSON5.
+func locatePositions(data []byte, source, ext string) positions {
+	switch ext {
+	case ".toml", ".tml":
+		return locateTOMLPositions(data, source)
+	case ".hcl":
+		return locateHCLPositions(data, source)
+	case ".json5", ".jsonc":
+		pos, _ := locateJSON5Positions(data, source)
+
+		return pos
+	case ".ini":
+		return locateINIPositions(data, source)
+	case ".env":
+		entries, err := parseDotenv(data)
+
+		return locateFlatPositions(entries, err, source)
+	case ".properties":
+		entries, err := parseProperties(data)
+
+		return locateFlatPositions(entries, err, source)
+	}
+
+	pos, ok := locateYAMLPositions(data, source, yamlv3.MappingNode)
+	if ok {
+		return pos
+	}
+
+	// JSON with comments is not YAML, see Conflate.LenientJSON
+	pos, ok = locateJSON5Positions(data, source)
+	if ok {
+		return pos
+	}
+
+	return locateTOMLPositions(data, source)
+}
+
+// locateSequencePositions finds the positions of the values within data whose root is an array, such as a JSON patch.
+func locateSequencePositions(data []byte, source string) positions {
+	pos, _ := locateYAMLPositions(data, source, yamlv3.SequenceNode)
+
+	return pos
+}
+
+// locateYAMLPositions locates the positions in YAML data whose root node is of the given kind.
+func locateYAMLPositions(data []byte, source string, kind yamlv3.Kind) (positions, bool) {
+	var doc yamlv3.Node
+
+	err := yamlv3.Unmarshal(data, &doc)
+	if err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != kind {
+		return nil, false
+	}
+
+	pos := positions{}
+	pos.locateYAMLNode(rootContext(), source, doc.Content[0])
+
+	return pos, true
+}
+
+func (p positions) locateYAMLNode(ctx context, source string, node *yamlv3.Node) {
+	p[ctx.pointer()] = position{source: source, line: node.Line, column: node.Column}
+
+	//nolint:exhaustive // scalars and aliases have no children to locate
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			p.locateYAMLNode(ctx.add(node.Content[i].Value), source, node.Content[i+1])
+		}
+	case yamlv3.SequenceNode:
+		for i, item := range node.Content {
+			p.locateYAMLNode(ctx.addInt(i), source, item)
+		}
+	}
+}
+
+var (
+	tomlKeyPart    = `(?:[A-Za-z0-9_-]+|"(?:[^"\\]|\\.)*"|'[^']*')`
+	tomlKey        = regexp.MustCompile(tomlKeyPart)
+	tomlArrayTable = regexp.MustCompile(`^\[\[\s*(` + tomlKeyPart + `(?:\s*\.\s*` + tomlKeyPart + `)*)\s*\]\]`)
+	tomlTable      = regexp.MustCompile(`^\[\s*(` + tomlKeyPart + `(?:\s*\.\s*` + tomlKeyPart + `)*)\s*\]`)
+	tomlKeyValue   = regexp.MustCompile(`^(` + tomlKeyPart + `(?:\s*\.\s*` + tomlKeyPart + `)*)\s*=\s*`)
+)
+
+// locateTOMLPositions scans the TOML line by line for table headers and keys.
+// Values which span lines are skipped over, and the contents of inline tables are not located.
+func locateTOMLPositions(data []byte, source string) positions {
+	pos := positions{"": {source: source, line: 1, column: 1}}
+	arrays := map[string]int{}
+	table := rootContext()
+
+	var (
+		depth     int
+		multiline string
+	)
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+
+		if multiline != "" {
+			if tomlCloses(line, multiline) {
+				multiline = ""
+			}
+
+			continue
+		}
+
+		if depth > 0 {
+			depth += tomlDepth(line)
+
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := len(line) - len(trimmed)
+
+		if m := tomlArrayTable.FindStringSubmatch(trimmed); m != nil {
+			keys := tomlKeys(m[1])
+			ctx := resolveTOMLTable(arrays, keys[:len(keys)-1]).add(keys[len(keys)-1])
+			arrays[ctx.pointer()]++
+			table = ctx.addInt(arrays[ctx.pointer()] - 1)
+			pos[table.pointer()] = position{source: source, line: lineNo, column: indent + 1}
+
+			continue
+		}
+
+		if m := tomlTable.FindStringSubmatch(trimmed); m != nil {
+			table = resolveTOMLTable(arrays, tomlKeys(m[1]))
+			pos[table.pointer()] = position{source: source, line: lineNo, column: indent + 1}
+
+			continue
+		}
+
+		m := tomlKeyValue.FindStringSubmatch(trimmed)
+		if m == nil {
+			continue
+		}
+
+		ctx := table.add(tomlKeys(m[1])...)
+		pos[ctx.pointer()] = position{source: source, line: lineNo, column: indent + len(m[0]) + 1}
+
+		value := trimmed[len(m[0]):]
+		for _, delim := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(value, delim) && !tomlCloses(value[len(delim):], delim) {
+				multiline = delim
+			}
+		}
+
+		if multiline == "" {
+			depth = tomlDepth(value)
+		}
+	}
+
+	return pos
+}
+
+func resolveTOMLTable(arrays map[string]int, keys []string) context {
+	ctx := rootContext()
+
+	for _, key := range keys {
+		ctx = ctx.add(key)
+		if n, ok := arrays[ctx.pointer()]; ok {
+			ctx = ctx.addInt(n - 1)
+		}
+	}
+
+	return ctx
+}
+
+func tomlKeys(s string) []string {
+	keys := tomlKey.FindAllString(s, -1)
+
+	for i, key := range keys {
+		switch {
+		case strings.HasPrefix(key, `"`):
+			unquoted, err := strconv.Unquote(key)
+			if err == nil {
+				keys[i] = unquoted
+			}
+		case strings.HasPrefix(key, `'`):
+			keys[i] = strings.Trim(key, `'`)
+		}
+	}
+
+	return keys
+}
+
+// tomlCloses reports whether the text closes a multiline string opened by the delimiter,
+// which cannot be escaped within a literal string.
+func tomlCloses(s, delim string) bool {
+	for i := 0; ; i++ {
+		n := strings.Index(s[i:], delim)
+		if n < 0 {
+			return false
+		}
+
+		i += n
+
+		backslashes := 0
+		for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+			backslashes++
+		}
+
+		if delim == "'''" || backslashes%2 == 0 {
+			return true
+		}
+	}
+}
+
+// tomlDepth returns the change in nesting of arrays and inline tables over the line, ignoring strings and comments.
+func tomlDepth(line string) int {
+	var (
+		depth int
+		quote rune
+	)
+
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+
+	return depth
+}
@@ -0,0 +1,275 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosition_String(t *testing.T) {
+	assert.Equal(t, "file.yaml:3:7", position{source: "file.yaml", line: 3, column: 7}.String())
+	assert.Equal(t, "3:7", position{line: 3, column: 7}.String())
+	assert.True(t, position{}.isZero())
+}
+
+func TestLocatePositions_YAML(t *testing.T) {
+	pos := locatePositions([]byte(`db:
+  host: localhost
+  ports:
+    - 1
+    - 2
+`), "file.yaml", ".yaml")
+	assert.Equal(t, position{source: "file.yaml", line: 1, column: 1}, pos[""])
+	assert.Equal(t, position{source: "file.yaml", line: 2, column: 9}, pos["/db/host"])
+	assert.Equal(t, position{source: "file.yaml", line: 5, column: 7}, pos["/db/ports/1"])
+}
+
+func TestLocatePositions_JSON(t *testing.T) {
+	pos := locatePositions([]byte("{\n\t\"db\": {\n\t\t\"port\": 5432\n\t}\n}"), "file.json", ".json")
+	assert.Equal(t, position{source: "file.json", line: 3, column: 11}, pos["/db/port"])
+}
+
+func TestLocatePositions_TOML(t *testing.T) {
+	pos := locatePositions([]byte(`title = "x"
+ports = [
+  1,
+  2,
+]
+text = """
+a = 1
+"""
+
+[db]
+  host = "localhost"
+"a.b" = 1
+
+[[servers]]
+name = "one"
+
+[[servers]]
+name = "two"
+
+[servers.tls]
+cert.file = "x"
+`), "file.toml", ".toml")
+	assert.Equal(t, position{source: "file.toml", line: 1, column: 9}, pos["/title"])
+	assert.Equal(t, position{source: "file.toml", line: 2, column: 9}, pos["/ports"])
+	assert.NotContains(t, pos, "/a")
+	assert.Equal(t, position{source: "file.toml", line: 10, column: 1}, pos["/db"])
+	assert.Equal(t, position{source: "file.toml", line: 11, column: 10}, pos["/db/host"])
+	assert.Equal(t, position{source: "file.toml", line: 12, column: 9}, pos["/db/a.b"])
+	assert.Equal(t, position{source: "file.toml", line: 15, column: 8}, pos["/servers/0/name"])
+	assert.Equal(t, position{source: "file.toml", line: 18, column: 8}, pos["/servers/1/name"])
+	assert.Equal(t, position{source: "file.toml", line: 21, column: 13}, pos["/servers/1/tls/cert/file"])
+}
+
+func TestLocatePositions_TOMLWithoutExtension(t *testing.T) {
+	pos := locatePositions([]byte("[db]\nport = 1\n"), "", "")
+	assert.Equal(t, position{line: 2, column: 8}, pos["/db/port"])
+}
+
+func TestOrigins_Copy(t *testing.T) {
+	src := positions{
+		"/a":   {line: 1, column: 1},
+		"/a/0": {line: 2, column: 1},
+	}
+	dst := origins{}
+	dst.copy(rootContext().add("b"), rootContext().add("a"), []interface{}{1, 2}, src)
+	assert.Equal(t, origins{"/b": {src: src, ptr: "/a"}, "/b/0": {src: src, ptr: "/a/0"}, "/b/1": {src: src, ptr: "/a/1"}}, dst)
+	assert.Equal(t, position{line: 2, column: 1}, positionOf(dst, rootContext().add("b").addInt(0)))
+	assert.Equal(t, position{}, positionOf(dst, rootContext().add("b").addInt(1)))
+	assert.Equal(t, position{}, positionOf(nil, rootContext()))
+
+	var nilOrigins origins
+	nilOrigins.copy(rootContext(), rootContext(), 1, src)
+	assert.Nil(t, nilOrigins)
+}
+
+func TestLazyPositions(t *testing.T) {
+	var calls int
+
+	l := newLazyPositions(func() positions {
+		calls++
+
+		return positions{"/a": {line: 1, column: 4}}
+	})
+	assert.Equal(t, 0, calls)
+
+	pos, ok := l.locate("/a")
+	assert.True(t, ok)
+	assert.Equal(t, position{line: 1, column: 4}, pos)
+
+	_, ok = l.locate("/b")
+	assert.False(t, ok)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMovedPositions(t *testing.T) {
+	src := positions{"/a/b": {line: 2, column: 3}}
+	m := movedPositions{src: src, from: "/a", to: "/x/y"}
+
+	pos, ok := m.locate("/x/y/b")
+	assert.True(t, ok)
+	assert.Equal(t, position{line: 2, column: 3}, pos)
+
+	_, ok = m.locate("/x/yb")
+	assert.False(t, ok)
+
+	_, ok = movedPositions{to: "/x"}.locate("/x")
+	assert.False(t, ok)
+}
+
+func TestConflate_PositionsLocatedOnError(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/a.yaml": "db:\n  port: 5432\n",
+		"host/b.yaml": "db:\n  host: localhost\n",
+	})
+	err := c.AddFiles("mem://host/a.yaml", "mem://host/b.yaml")
+	assert.Nil(t, err)
+
+	lazy := func(ptr string) *lazyPositions {
+		l, _ := c.positions[ptr].src.(*lazyPositions)
+
+		return l
+	}
+
+	// the files are not parsed again to locate the values until a position is needed
+	assert.Nil(t, lazy("/db/port").pos)
+	assert.Nil(t, lazy("/db/host").pos)
+
+	s, err := NewSchemaData([]byte(`{"properties": {"db": {"properties": {"port": {"type": "string"}}}}}`))
+	assert.Nil(t, err)
+
+	err = c.Validate(s)
+	assert.Contains(t, err.Error(), "(#/db/port at mem://host/a.yaml:2:9)")
+	assert.NotNil(t, lazy("/db/port").pos)
+	assert.Nil(t, lazy("/db/host").pos)
+}
+
+func TestContextError_Position(t *testing.T) {
+	err := contextError{msg: "bad", context: rootContext().add("db"), position: position{source: "file.yaml", line: 3, column: 7}}
+	assert.Equal(t, "bad (#/db at file.yaml:3:7)", err.Error())
+}
+
+func TestConflate_MergeErrorPosition(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/a.yaml": "db:\n  port: 5432\n",
+		"host/b.toml": "[db]\nport = \"high\"\n",
+	})
+	err := c.AddFiles("mem://host/a.yaml", "mem://host/b.toml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "(#/db/port at mem://host/b.toml:2:8)")
+}
+
+func TestConflate_ValidateErrorPosition(t *testing.T) {
+	c := testMemConflate(map[string]string{
+		"host/a.yaml": "db:\n  port: 5432\n",
+		"host/b.yaml": "db:\n  host: localhost\n",
+	})
+	err := c.AddFiles("mem://host/a.yaml", "mem://host/b.yaml")
+	assert.Nil(t, err)
+
+	s, err := NewSchemaData([]byte(`{"properties": {"db": {"properties": {"port": {"type": "string"}}}}}`))
+	assert.Nil(t, err)
+
+	err = c.Validate(s)
+	assert.ErrorIs(t, err, errInvalidPerSchema)
+	assert.Contains(t, err.Error(), "(#/db/port at mem://host/a.yaml:2:9)")
+}
+
+func TestFiledata_ValidateErrorPosition(t *testing.T) {
+	l := newLoader()
+	_, err := l.newFiledata([]byte("includes: 1\n"), &emptyURL)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "at 1:11)")
+}
+
+func TestLocatePositions_TOMLMultilineStrings(t *testing.T) {
+	data := []byte(`basic = """
+key = 1
+[fake]
+"""
+literal = '''
+[[fake]]
+other = 2'''
+single = """one line"""
+escaped = """a \""" b
+c = 3
+"""
+after = "[not a table]"
+`)
+	pos := locatePositions(data, "", ".toml")
+	assert.Equal(t, position{line: 1, column: 9}, pos["/basic"])
+	assert.Equal(t, position{line: 5, column: 11}, pos["/literal"])
+	assert.Equal(t, position{line: 8, column: 10}, pos["/single"])
+	assert.Equal(t, position{line: 9, column: 11}, pos["/escaped"])
+	assert.Equal(t, position{line: 12, column: 9}, pos["/after"])
+	testTOMLPositionsExist(t, data, pos)
+}
+
+func TestLocatePositions_TOMLInlineTables(t *testing.T) {
+	data := []byte(`point = { x = 1, y = { z = "}" } }
+points = [
+  { x = 1 },
+  { x = 2, nested = { y = [1, 2] } }, # a comment with ]
+]
+[db]
+conn = { host = "localhost", port = 5432 }
+`)
+	pos := locatePositions(data, "", ".toml")
+	assert.Equal(t, position{line: 1, column: 9}, pos["/point"])
+	assert.Equal(t, position{line: 2, column: 10}, pos["/points"])
+	assert.Equal(t, position{line: 6, column: 1}, pos["/db"])
+	assert.Equal(t, position{line: 7, column: 8}, pos["/db/conn"])
+	testTOMLPositionsExist(t, data, pos)
+}
+
+func TestLocatePositions_TOMLArraysOfTables(t *testing.T) {
+	data := []byte(`[[fruit]]
+name = "apple"
+
+  [fruit.physical]
+  color = "red"
+
+  [[fruit.variety]]
+  name = "red delicious"
+
+  [[fruit.variety]]
+  name = "granny smith"
+
+[[fruit]]
+name = "banana"
+
+  [[fruit.variety]]
+  name = "plantain"
+`)
+	pos := locatePositions(data, "", ".toml")
+	assert.Equal(t, position{line: 1, column: 1}, pos["/fruit/0"])
+	assert.Equal(t, position{line: 2, column: 8}, pos["/fruit/0/name"])
+	assert.Equal(t, position{line: 5, column: 11}, pos["/fruit/0/physical/color"])
+	assert.Equal(t, position{line: 8, column: 10}, pos["/fruit/0/variety/0/name"])
+	assert.Equal(t, position{line: 11, column: 10}, pos["/fruit/0/variety/1/name"])
+	assert.Equal(t, position{line: 13, column: 1}, pos["/fruit/1"])
+	assert.Equal(t, position{line: 14, column: 8}, pos["/fruit/1/name"])
+	assert.Equal(t, position{line: 16, column: 3}, pos["/fruit/1/variety/0"])
+	assert.Equal(t, position{line: 17, column: 10}, pos["/fruit/1/variety/0/name"])
+	testTOMLPositionsExist(t, data, pos)
+}
+
+// testTOMLPositionsExist checks that each value located within the TOML data is found there when it is unmarshalled.
+func testTOMLPositionsExist(t *testing.T, data []byte, pos positions) {
+	t.Helper()
+
+	var out interface{}
+
+	err := TOMLUnmarshal(data, &out)
+	assert.Nil(t, err)
+
+	err = jsonMarshalUnmarshal(out, &out)
+	assert.Nil(t, err)
+
+	for ptr := range pos {
+		_, err := lookupPointer(out, ptr)
+		assert.Nil(t, err, ptr)
+	}
+}
@@ -0,0 +1,247 @@
+package conflate
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Provenance describes which source set a value in the merged data.
+type Provenance struct {
+	// Path is the JSON pointer to the value.
+	Path string `json:"path"`
+	// Source is the url of the data that set the value, or blank for data that was not loaded from a url.
+	Source string `json:"source"`
+	// Overridden lists the sources of any values replaced by the current one, in the order they were merged.
+	Overridden []string `json:"overridden,omitempty"`
+	// Deleted is set if the source deleted the value, along with any values below it.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func (p Provenance) String() string {
+	s := fmt.Sprintf("%v: %v", p.Path, sourceName(p.Source))
+	if p.Deleted {
+		s = fmt.Sprintf("%v: deleted by %v", p.Path, sourceName(p.Source))
+	}
+
+	if len(p.Overridden) == 0 {
+		return s
+	}
+
+	names := make([]string, len(p.Overridden))
+	for i, source := range p.Overridden {
+		names[i] = sourceName(source)
+	}
+
+	return fmt.Sprintf("%v (overrides %v)", s, strings.Join(names, ", "))
+}
+
+func sourceName(source string) string {
+	if source == "" {
+		return "<data>"
+	}
+
+	return source
+}
+
+// provenances maps the JSON pointer of each value in the merged data to its provenance.
+// A nil map records nothing, so that tracking provenance costs nothing unless it is enabled.
+// Deleted array items are recorded under their pointer followed by ~~ and a sequence number,
+// which is never a valid JSON pointer, as the items after them move into their place.
+type provenances map[string]*Provenance
+
+const deletedItemSeparator = "~~"
+
+func (p provenances) record(ctx context, source string, value interface{}) {
+	if p == nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, val := range v {
+			p.record(ctx.add(name), source, val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			p.record(ctx.addInt(i), source, val)
+		}
+	default:
+		p.set(ctx.pointer(), source)
+	}
+}
+
+func (p provenances) set(ptr, source string) {
+	// a value set below a deleted one revives its ancestors
+	for anc := ptr; anc != ""; {
+		anc = anc[:strings.LastIndex(anc, "/")]
+		if prov, ok := p[anc]; ok && prov.Deleted {
+			delete(p, anc)
+		}
+	}
+
+	prov, ok := p[ptr]
+	if !ok {
+		p[ptr] = &Provenance{Path: ptr, Source: source}
+
+		return
+	}
+
+	prov.Overridden = append(prov.Overridden, prov.Source)
+	prov.Source = source
+	prov.Deleted = false
+}
+
+// delete records that the source deleted the value at ctx, which overrides the sources of the value and those below it.
+func (p provenances) delete(ctx context, source string) {
+	if p == nil {
+		return
+	}
+
+	p[ctx.pointer()] = p.deletion(ctx, source)
+}
+
+// deleteItem records that the source deleted the array item at ctx, before the items after it are moved down.
+func (p provenances) deleteItem(ctx context, source string) {
+	if p == nil {
+		return
+	}
+
+	prov := p.deletion(ctx, source)
+
+	n := 0
+	for p.deletedItemKey(ctx.pointer(), n) != "" {
+		n++
+	}
+
+	p[fmt.Sprintf("%v%v%v", ctx.pointer(), deletedItemSeparator, n)] = prov
+}
+
+// deletedItemKey returns the key of the nth deleted item recorded at the pointer, or blank if there is none.
+func (p provenances) deletedItemKey(ptr string, n int) string {
+	key := fmt.Sprintf("%v%v%v", ptr, deletedItemSeparator, n)
+	if _, ok := p[key]; !ok {
+		return ""
+	}
+
+	return key
+}
+
+// deletion forgets the provenance of the value at ctx and those below it,
+// and returns the record of its deletion by the source, which overrides all of their sources.
+func (p provenances) deletion(ctx context, source string) *Provenance {
+	var overridden []string
+
+	for _, prov := range p.below(ctx) {
+		for _, s := range append(prov.Overridden, prov.Source) {
+			if !slices.Contains(overridden, s) {
+				overridden = append(overridden, s)
+			}
+		}
+	}
+
+	p.remove(ctx)
+
+	return &Provenance{Path: ctx.pointer(), Source: source, Overridden: overridden, Deleted: true}
+}
+
+// below returns the provenance of the value at ctx and those below it, ordered by JSON pointer.
+func (p provenances) below(ctx context) []*Provenance {
+	var ptrs []string
+
+	for ptr := range p {
+		if ptr == ctx.pointer() || isBelow(ptr, ctx.pointer()) {
+			ptrs = append(ptrs, ptr)
+		}
+	}
+
+	// the keys rather than the paths are sorted, as the deleted items at a path share it
+	sort.Strings(ptrs)
+
+	provs := make([]*Provenance, len(ptrs))
+	for i, ptr := range ptrs {
+		provs[i] = p[ptr]
+	}
+
+	return provs
+}
+
+// remove forgets the provenance of the value at ctx and those below it.
+func (p provenances) remove(ctx context) {
+	delete(p, ctx.pointer())
+	p.clear(ctx)
+}
+
+func (p provenances) shift(ctx context, start, offset int) {
+	moved := provenances{}
+
+	for ptr, prov := range p {
+		if shifted, ok := shiftIndex(ptr, ctx.pointer(), start, offset); ok {
+			delete(p, ptr)
+			prov.Path = shifted
+			moved[shifted] = prov
+		}
+	}
+
+	for ptr, prov := range moved {
+		p[ptr] = prov
+	}
+}
+
+func (p provenances) clear(ctx context) {
+	for ptr := range p {
+		if isBelow(ptr, ctx.pointer()) {
+			delete(p, ptr)
+		}
+	}
+}
+
+func (p provenances) clone() provenances {
+	if p == nil {
+		return nil
+	}
+
+	cp := make(provenances, len(p))
+	for ptr := range p {
+		cp[ptr] = p.get(ptr)
+	}
+
+	return cp
+}
+
+// get returns a copy of the provenance of the value at the pointer,
+// or of the last array item deleted there if there is no longer a value at the pointer.
+func (p provenances) get(ptr string) *Provenance {
+	prov, ok := p[ptr]
+
+	for n := 0; !ok && p.deletedItemKey(ptr, n) != ""; n++ {
+		prov = p[p.deletedItemKey(ptr, n)]
+	}
+
+	if prov == nil {
+		return nil
+	}
+
+	cp := *prov
+	cp.Overridden = append([]string(nil), prov.Overridden...)
+
+	return &cp
+}
+
+// sorted returns the provenances ordered by JSON pointer, with any items deleted at a pointer after its value.
+func (p provenances) sorted() []Provenance {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	provs := make([]Provenance, 0, len(p))
+	for _, key := range keys {
+		provs = append(provs, *p.get(key))
+	}
+
+	return provs
+}
@@ -0,0 +1,81 @@
+package conflate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testProvenanceConflate(t *testing.T) *Conflate {
+	t.Helper()
+
+	c := testMemConflate(map[string]string{
+		"host/base.json":  `{"db": {"host": "localhost", "port": 5432}, "tags": ["a"]}`,
+		"host/env.json":   `{"db": {"host": "db.internal"}, "tags": ["b"]}`,
+		"host/local.json": `{"db": {"host": "127.0.0.1"}}`,
+	}, WithProvenance(true))
+
+	err := c.AddFiles("mem://host/base.json", "mem://host/env.json", "mem://host/local.json")
+	assert.Nil(t, err)
+
+	return c
+}
+
+func TestProvenance_Override(t *testing.T) {
+	c := testProvenanceConflate(t)
+	assert.Equal(t, &Provenance{
+		Path:       "/db/host",
+		Source:     "mem://host/local.json",
+		Overridden: []string{"mem://host/base.json", "mem://host/env.json"},
+	}, c.Provenance("/db/host"))
+	assert.Equal(t, &Provenance{Path: "/db/port", Source: "mem://host/base.json"}, c.Provenance("/db/port"))
+}
+
+func TestProvenance_ArrayItems(t *testing.T) {
+	c := testProvenanceConflate(t)
+	assert.Equal(t, "mem://host/base.json", c.Provenance("/tags/0").Source)
+	assert.Equal(t, "mem://host/env.json", c.Provenance("/tags/1").Source)
+}
+
+func TestProvenance_Unknown(t *testing.T) {
+	c := testProvenanceConflate(t)
+	assert.Nil(t, c.Provenance("/db"))
+	assert.Nil(t, c.Provenance("/missing"))
+}
+
+func TestProvenance_ReturnsCopy(t *testing.T) {
+	c := testProvenanceConflate(t)
+	prov := c.Provenance("/db/host")
+	prov.Overridden[0] = "changed"
+	assert.Equal(t, "mem://host/base.json", c.Provenance("/db/host").Overridden[0])
+}
+
+func TestProvenance_NotTracked(t *testing.T) {
+	c, err := FromData([]byte(`{"x": 1}`))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Provenance("/x"))
+	assert.Equal(t, "", c.Explain())
+}
+
+func TestProvenance_TrackProvenanceOff(t *testing.T) {
+	c := testProvenanceConflate(t)
+	c.TrackProvenance(false)
+	assert.Nil(t, c.Provenance("/db/host"))
+}
+
+func TestProvenance_Data(t *testing.T) {
+	c := New(WithProvenance(true))
+	err := c.AddData([]byte(`{"x": 1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, &Provenance{Path: "/x", Source: ""}, c.Provenance("/x"))
+	assert.Equal(t, "/x: <data>\n", c.Explain())
+}
+
+func TestExplain(t *testing.T) {
+	c := testProvenanceConflate(t)
+	assert.Equal(t, `/db/host: mem://host/local.json (overrides mem://host/base.json, mem://host/env.json)
+/db/port: mem://host/base.json
+/tags/0: mem://host/base.json
+/tags/1: mem://host/env.json
+`, c.Explain())
+}
@@ -1,6 +1,7 @@
 package conflate
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
 	"math"
@@ -32,17 +33,27 @@ type Schema struct {
 
 // NewSchemaFile loads a JSON v4 schema from the given path.
 func NewSchemaFile(path string) (*Schema, error) {
+	return NewSchemaFileContext(gocontext.Background(), path)
+}
+
+// NewSchemaFileContext is like NewSchemaFile, but aborts loading when ctx is done.
+func NewSchemaFileContext(ctx gocontext.Context, path string) (*Schema, error) {
 	u, err := toURL(nil, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to obtain url to schema file: %w", err)
 	}
 
-	return NewSchemaURL(u)
+	return NewSchemaURLContext(ctx, u)
 }
 
 // NewSchemaURL loads a JSON v4 schema from the given URL.
 func NewSchemaURL(u *url.URL) (*Schema, error) {
-	data, err := loadURL(u)
+	return NewSchemaURLContext(gocontext.Background(), u)
+}
+
+// NewSchemaURLContext is like NewSchemaURL, but aborts loading when ctx is done.
+func NewSchemaURLContext(ctx gocontext.Context, u *url.URL) (*Schema, error) {
+	data, err := loadURL(ctx, u)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load schema url %v: %w", u, err)
 	}
@@ -91,12 +102,10 @@ func (s *Schema) ApplyDefaults(pData interface{}) error {
 	return applyDefaults(pData, s.s)
 }
 
-var metaSchema interface{}
-
-func updateMetaSchema(s interface{}) (draft string, err error) {
+func loadMetaSchema(s interface{}) (draft string, metaSchema interface{}, err error) {
 	m, ok := s.(map[string]interface{})
 	if !ok {
-		return "Unknown", errInvalidSchemaStructure
+		return "Unknown", nil, errInvalidSchemaStructure
 	}
 
 	// use schema draft 04 if we don't have a key to specify it
@@ -112,10 +121,10 @@ func updateMetaSchema(s interface{}) (draft string, err error) {
 
 	err = JSONUnmarshal(data, &metaSchema)
 	if err != nil {
-		return draft, fmt.Errorf("could not load json meta-schema: %w", err)
+		return draft, nil, fmt.Errorf("could not load json meta-schema: %w", err)
 	}
 
-	return draft, nil
+	return draft, metaSchema, nil
 }
 
 func validateSchema(schema interface{}) (string, error) {
@@ -134,7 +143,7 @@ func validateSchema(schema interface{}) (string, error) {
 		return draft, fmt.Errorf("schema validation failed: %w", err)
 	}
 
-	draft, err := updateMetaSchema(schema)
+	draft, metaSchema, err := loadMetaSchema(schema)
 	if err != nil {
 		return draft, fmt.Errorf("cannot access the schema draft: %w", err)
 	}
@@ -143,17 +152,22 @@ func validateSchema(schema interface{}) (string, error) {
 }
 
 func validate(data, schema interface{}) error {
+	return validateAt(data, schema, nil)
+}
+
+// validateAt validates the data, citing the positions of any invalid values in the error.
+func validateAt(data, schema interface{}, pos locator) error {
+	initFormatCheckers()
+
 	dataLoader := gojsonschema.NewGoLoader(data)
 	schemaLoader := gojsonschema.NewGoLoader(schema)
 
-	formatErrs.clear()
-
 	result, err := gojsonschema.Validate(schemaLoader, dataLoader)
 	if err != nil {
 		return fmt.Errorf("an error occurred during validation: %w", err)
 	}
 
-	err = processResult(result)
+	err = processResult(result, pos)
 	if err != nil {
 		return fmt.Errorf("schema validation failed: %w", err)
 	}
@@ -161,17 +175,17 @@ func validate(data, schema interface{}) error {
 	return nil
 }
 
-func processResult(result *gojsonschema.Result) error {
+func processResult(result *gojsonschema.Result, pos locator) error {
 	if !result.Valid() {
 		err := errInvalidPerSchema
 
 		for _, rerr := range result.Errors() {
 			ctx := convertJSONContext(rerr.Context().String())
-			ctxErr := &contextError{msg: rerr.Description(), context: ctx}
+			ctxErr := &contextError{msg: rerr.Description(), context: ctx, position: positionOf(pos, ctx)}
 
 			err = fmt.Errorf("%w: %w", err, ctxErr)
 
-			ferr := formatErrs.get(rerr.Details()["format"], rerr.Value())
+			ferr := formatError(rerr.Details()["format"], rerr.Value())
 			if ferr != nil {
 				err = fmt.Errorf("%w: %v", err, ferr.Error())
 			}
@@ -247,7 +261,8 @@ func applyDefaultsRecursive(ctx context, rootSchema, pData, schema interface{})
 	}
 
 	if value, ok := schemaNode["default"]; ok && data == nil {
-		defaultVal := reflect.ValueOf(value)
+		// copy the default, so that the data never shares maps or slices with the schema
+		defaultVal := reflect.ValueOf(deepCopy(value))
 		dataVal.Set(defaultVal)
 		data = dataVal.Interface()
 	}
@@ -1,6 +1,9 @@
 package conflate
 
 import (
+	gocontext "context"
+	"net/url"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,8 +40,30 @@ func TestSchema_NewSchema(t *testing.T) {
 	assert.NotNil(t, s.s)
 }
 
+func TestSchema_NewSchemaURLGlobalLoader(t *testing.T) {
+	Loaders["mem"] = testMemoryLoader(map[string]string{"host/schema.json": `{"type": "object"}`})
+
+	defer delete(Loaders, "mem")
+
+	u, err := url.Parse("mem://host/schema.json")
+	assert.Nil(t, err)
+
+	s, err := NewSchemaURL(u)
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+}
+
+func TestSchema_NewSchemaFileContextCancelled(t *testing.T) {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	s, err := NewSchemaFileContext(ctx, "testdata/test.schema.json")
+	assert.NotNil(t, err)
+	assert.Nil(t, s)
+	assert.ErrorIs(t, err, gocontext.Canceled)
+}
+
 func TestNewSchemaGo_ValidateSchema(t *testing.T) {
-	metaSchema = nil
 	data := `{"title": "testdata"}`
 
 	var schema interface{}
@@ -49,7 +74,6 @@ func TestNewSchemaGo_ValidateSchema(t *testing.T) {
 	s, err := NewSchemaGo(schema)
 	assert.NotNil(t, s)
 	assert.Nil(t, err)
-	assert.NotNil(t, metaSchema)
 }
 
 func TestNewSchemaGo_ValidateSchemaAnyOf(t *testing.T) {
@@ -66,12 +90,10 @@ func TestNewSchemaGo_ValidateSchemaAnyOf(t *testing.T) {
 }
 
 func TestNewSchemaGo_ValidateSchemaInvalidMetaData(t *testing.T) {
-	metaSchema = nil
 	oldMetaSchemaData := metaSchemaData
 
 	defer func() {
 		metaSchemaData = oldMetaSchemaData
-		metaSchema = nil
 	}()
 
 	metaSchemaData = map[string][]byte{draft04: []byte(`{"invalid": "json" `)}
@@ -88,16 +110,15 @@ func TestNewSchemaGo_ValidateSchemaInvalidMetaData(t *testing.T) {
 	assert.Contains(t, err.Error(), "could not load json meta-schema")
 }
 
-func TestUpdateMetaSchema_InvalidSchema(t *testing.T) {
+func TestLoadMetaSchema_InvalidSchema(t *testing.T) {
 	var schema interface{}
 
-	_, err := updateMetaSchema(schema)
+	_, _, err := loadMetaSchema(schema)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "invalid schema structure")
 }
 
-func TestUpdateMetaSchema_DefaultDraft(t *testing.T) {
-	metaSchema = nil
+func TestLoadMetaSchema_DefaultDraft(t *testing.T) {
 	data := `{"no": "draft"}`
 
 	var schema interface{}
@@ -105,7 +126,7 @@ func TestUpdateMetaSchema_DefaultDraft(t *testing.T) {
 	err := JSONUnmarshal([]byte(data), &schema)
 	assert.Nil(t, err)
 
-	draft, err := updateMetaSchema(schema)
+	draft, metaSchema, err := loadMetaSchema(schema)
 	assert.Nil(t, err)
 	assert.Equal(t, draft, draft04)
 
@@ -115,8 +136,7 @@ func TestUpdateMetaSchema_DefaultDraft(t *testing.T) {
 	assert.Equal(t, schemaData, metaSchema)
 }
 
-func TestUpdateMetaSchema_ReadDraft(t *testing.T) {
-	metaSchema = nil
+func TestLoadMetaSchema_ReadDraft(t *testing.T) {
 	data := `{"$schema": "http://json-schema.org/draft-06/schema#"}`
 
 	var schema interface{}
@@ -124,7 +144,7 @@ func TestUpdateMetaSchema_ReadDraft(t *testing.T) {
 	err := JSONUnmarshal([]byte(data), &schema)
 	assert.Nil(t, err)
 
-	draft, err := updateMetaSchema(schema)
+	draft, metaSchema, err := loadMetaSchema(schema)
 	assert.Nil(t, err)
 	assert.Equal(t, draft, draft06)
 
@@ -218,6 +238,85 @@ func TestValidate_CustomFormatError(t *testing.T) {
 
 // -----------
 
+func TestSchema_ValidateConcurrent(t *testing.T) {
+	s, err := NewSchemaData([]byte(`{"type": "object", "properties": {"pattern": {"type": "string", "format": "regex"}}}`))
+	assert.Nil(t, err)
+
+	tenants := map[string]string{
+		"^(a":   "missing closing )",
+		"[b":    "missing closing ]",
+		"c**":   "invalid nested repetition operator",
+		"^.*$":  "",
+		"^ok$":  "",
+		"x{2,1": "",
+	}
+
+	var wg sync.WaitGroup
+
+	for range 20 {
+		for pattern, expected := range tenants {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := s.Validate(map[string]interface{}{"pattern": pattern})
+				if expected == "" {
+					assert.Nil(t, err)
+
+					return
+				}
+
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), expected)
+			}()
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestSchema_ApplyDefaultsConcurrent(t *testing.T) {
+	s, err := NewSchemaData([]byte(`{
+		"type": "object",
+		"properties": {
+			"db": {"type": "object", "default": {"hosts": ["a"]}, "properties": {"port": {"type": "integer", "default": 1}}}
+		}
+	}`))
+	assert.Nil(t, err)
+
+	datas := make([]interface{}, 20)
+
+	var wg sync.WaitGroup
+
+	for i := range datas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			datas[i] = map[string]interface{}{}
+			err := s.ApplyDefaults(&datas[i])
+			assert.Nil(t, err)
+
+			db, ok := datas[i].(map[string]interface{})["db"].(map[string]interface{})
+			assert.True(t, ok)
+
+			db["port"] = i
+		}()
+	}
+
+	wg.Wait()
+
+	// the defaults are copied, so no tenant sees another tenant's changes, nor are they written back to the schema
+	for i, data := range datas {
+		assert.Equal(t, i, data.(map[string]interface{})["db"].(map[string]interface{})["port"])
+	}
+
+	assert.Equal(t, map[string]interface{}{"hosts": []interface{}{"a"}},
+		s.s.(map[string]interface{})["properties"].(map[string]interface{})["db"].(map[string]interface{})["default"])
+}
+
 func TestApplyDefaults_DataNil(t *testing.T) {
 	schema := map[string]interface{}{}
 	err := applyDefaults(nil, schema)